@@ -0,0 +1,195 @@
+package configo
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/BurntSushi/toml"
+	"github.com/kimor79/configo/internal/tags"
+)
+
+// An "alias" tag lists the former names of a renamed setting, e.g.
+// `alias:"toml:mysql.dsn,env:MYSQL_DSN"`. Names prefixed with "env:" are
+// environment variables, read by EnvConfigo with its prefix prepended, as
+// for "env" tags. Names prefixed with "toml:", or with no prefix, are dotted
+// TOML keys from the root of the file, read by TomlConfigo. Upper case names
+// such as "MYSQL_DSN" must carry either prefix, and invalid names are
+// reported with ErrInvalidAlias rather than ignored. A former name is
+// only used when the setting is not given under its current name, and a
+// warning is logged whenever it is found.
+//
+// A "deprecated" tag marks a setting that should no longer be used, e.g.
+// `deprecated:"use database.url"`. A warning carrying the tag is logged
+// whenever the setting is found.
+//
+// Warnings are only logged to a Logger given to the source or its
+// ConfigoChain; without one they are dropped.
+
+// logged is implemented by sources that log warnings, so a ConfigoChain can
+// hand them its Logger.
+type logged interface {
+	useLogger(l Logger)
+}
+
+// splitAliases splits the "alias" tag `tag` into TOML keys and environment
+// variables, as tags.SplitAliases does.
+func splitAliases(tag string) (keys, envs []string, err error) {
+	return tags.SplitAliases(tag)
+}
+
+// warnDeprecated logs that the setting `name` is deprecated, naming the
+// setting replacing it if any and the "deprecated" tag `msg` of the field.
+// Nothing is logged when `l` is nil.
+func warnDeprecated(l Logger, name, replacement, msg string) {
+	s := "configo: " + name + " is deprecated"
+	if replacement != "" {
+		s += ", use " + replacement
+	}
+
+	if msg != "" {
+		s += ": " + msg
+	}
+
+	logf(l, "%s", s)
+}
+
+// logf logs to `l`, unless it is nil.
+func logf(l Logger, format string, v ...interface{}) {
+	if l != nil {
+		l.Printf(format, v...)
+	}
+}
+
+// tomlAliasField is a field with TOML aliases or a "deprecated" tag.
+type tomlAliasField struct {
+	// index leads from the root struct to the field, one entry per struct.
+	index      [][]int
+	key        string
+	aliases    []string
+	deprecated string
+}
+
+// tomlAliasFields lists the fields of struct type `t` with TOML aliases or
+// a "deprecated" tag, and adds to `errs` those with invalid aliases.
+func tomlAliasFields(t reflect.Type, index [][]int, path, key string, fields *[]tomlAliasField, errs *LoadErrors) {
+	plan := planFor(derefType(t))
+
+	for i := range plan.fields {
+		fp := &plan.fields[i]
+		findex := append(index[:len(index):len(index)], []int{fp.index})
+		fpath := joinPath(path, fp.name)
+		fkey := joinPath(key, fp.tomlKey)
+
+		if fp.aliasErr != nil {
+			errs.add(newFieldError(fpath, "alias", fp.alias, false, fp.aliasErr))
+		}
+
+		if fp.structType {
+			tomlAliasFields(derefType(t).Field(fp.index).Type, findex, fpath, fkey, fields, errs)
+		}
+
+		if fp.tomlAliases != nil || fp.deprecated != "" {
+			*fields = append(*fields, tomlAliasField{index: findex, key: fkey, aliases: fp.tomlAliases, deprecated: fp.deprecated})
+		}
+	}
+}
+
+// tomlAliases sets the fields of `nv`, a pointer to the struct the file `f`
+// was decoded into, from their aliases in the document `b` when the file
+// does not set them under their current key, and logs a warning for every
+// alias or deprecated key found. The line of an alias used is recorded in
+// `lines` under the current key, which is marked `defined`. It returns the
+// aliases found, so they are not reported as unknown.
+func tomlAliases(f string, b []byte, nv reflect.Value, lines map[string]int, defined map[string]bool, l Logger) (map[string]bool, error) {
+	var fields []tomlAliasField
+	var errs LoadErrors
+	tomlAliasFields(nv.Type(), nil, "", "", &fields, &errs)
+
+	if fields == nil {
+		return nil, errs.err()
+	}
+
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(b), &doc); err != nil {
+		return nil, err
+	}
+
+	found := map[string]bool{}
+
+	for _, fa := range fields {
+		_, set := tomlLookup(doc, fa.key)
+
+		if set && fa.deprecated != "" {
+			warnDeprecated(l, fmt.Sprintf("key %q in %s", fa.key, tomlPos(f, lines[fa.key])), "", fa.deprecated)
+		}
+
+		for _, alias := range fa.aliases {
+			akey := normalizeTomlKey(alias)
+
+			raw, ok := tomlLookup(doc, akey)
+			if !ok {
+				continue
+			}
+
+			found[akey] = true
+
+			name := fmt.Sprintf("key %q in %s", alias, tomlPos(f, lines[akey]))
+			if set {
+				logf(l, "configo: %s is ignored since %q is set", name, fa.key)
+				continue
+			}
+
+			warnDeprecated(l, name, fmt.Sprintf("%q", fa.key), fa.deprecated)
+
+			val := nv.Elem()
+			for _, index := range fa.index {
+				if val.Kind() == reflect.Ptr {
+					if val.IsNil() {
+						val.Set(reflect.New(val.Type().Elem()))
+					}
+
+					val = val.Elem()
+				}
+
+				val = val.FieldByIndex(index)
+			}
+
+			err := tomlDecodeValue(raw, val)
+			if err != nil {
+				path, secret := tomlKeyField(nv.Type(), fa.key)
+				errs.add(newFieldError(path, "toml:"+tomlPos(f, lines[akey]), fmt.Sprint(raw), secret, err))
+				break
+			}
+
+			lines[fa.key] = lines[akey]
+			defined[fa.key] = true
+			set = true
+		}
+	}
+
+	return found, errs.err()
+}
+
+// tomlDecodeValue decodes the value `raw`, as found in a decoded document,
+// into `dst` the way the field holding it would have been decoded.
+func tomlDecodeValue(raw interface{}, dst reflect.Value) error {
+	var buf bytes.Buffer
+
+	err := toml.NewEncoder(&buf).Encode(map[string]interface{}{"v": raw})
+	if err != nil {
+		return err
+	}
+
+	holder := reflect.New(reflect.StructOf([]reflect.StructField{
+		{Name: "V", Type: dst.Type(), Tag: `toml:"v"`},
+	}))
+
+	_, err = toml.Decode(buf.String(), holder.Interface())
+	if err != nil {
+		return err
+	}
+
+	dst.Set(holder.Elem().Field(0))
+	return nil
+}
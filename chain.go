@@ -1,7 +1,10 @@
 package configo
 
+import "reflect"
+
 type ConfigoChain struct {
 	configos []Configo
+	prov     Provenance
 }
 
 func NewConfigoChain(configos ...Configo) *ConfigoChain {
@@ -13,17 +16,123 @@ func NewDefaultConfigoChain(file string) *ConfigoChain {
 		NewDefaultsConfigo(),
 		NewTomlConfigo(file),
 		NewEnvConfigo(),
+		NewValidateConfigo(),
 	}
 	return &ConfigoChain{configos: configos}
 }
 
+// TrackProvenance makes Load record into `p` where the value of every field
+// it sets came from. Values set by sources other than the ones provided by
+// this package are not tracked.
+func (chain *ConfigoChain) TrackProvenance(p Provenance) *ConfigoChain {
+	chain.prov = p
+	return chain
+}
+
+// Logger makes the sources of the chain that log warnings, such as those
+// about deprecated settings, log them to `l` unless given a Logger of their
+// own.
+func (chain *ConfigoChain) Logger(l Logger) *ConfigoChain {
+	for _, c := range chain.configos {
+		if lc, ok := c.(logged); ok {
+			lc.useLogger(l)
+		}
+	}
+	return chain
+}
+
+// files returns the files read by the sources of the chain.
+func (chain *ConfigoChain) files() []string {
+	var files []string
+	for _, c := range chain.configos {
+		if fs, ok := c.(fileSource); ok {
+			files = append(files, fs.files()...)
+		}
+	}
+	return files
+}
+
+// deferredSource is implemented by sources that leave part of their work,
+// such as derived defaults, until the sources setting values have run.
+type deferredSource interface {
+	loadDeferred(v interface{}, p Provenance) (finish func() error, err error)
+}
+
+// mergedSource is implemented by sources that act on the merged config
+// rather than set values from a source of their own.
+type mergedSource interface {
+	merged()
+}
+
+// originSource is implemented by sources acting on values depending on
+// where they came from, so a ConfigoChain tracks provenance for them even
+// when not asked to.
+type originSource interface {
+	loadOrigins(v interface{}, p Provenance) error
+}
+
+// Load applies every source in order. A failing source does not stop the
+// chain; the returned error is a *LoadErrors listing the failures of all
+// sources.
+//
+// The work deferred by sources, such as evaluating derived defaults, is done
+// once the sources setting values have run: before the first source acting
+// on the merged config, such as ValidateConfigo, or after the last source.
+//
+// Once every source has been applied, AfterLoad is called on each struct in
+// `v` implementing Finalizer, then Validate on each implementing Validator.
+// Nested structs are visited before the struct containing them.
 func (chain *ConfigoChain) Load(v interface{}) error {
-	var err error
+	var errs LoadErrors
+
+	_, err := target(v)
+	if err != nil {
+		return err
+	}
+
+	prov := chain.prov
+	for _, c := range chain.configos {
+		if _, ok := c.(originSource); ok && prov == nil {
+			prov = Provenance{}
+		}
+	}
+
+	if prov != nil {
+		recordCaller(reflect.ValueOf(v), "", prov)
+	}
+
+	var deferred []func() error
+	finish := func() {
+		for _, f := range deferred {
+			errs.add(f())
+		}
+		deferred = nil
+	}
+
 	for _, c := range chain.configos {
-		err = c.Load(v)
-		if err != nil {
-			return err
+		if _, ok := c.(mergedSource); ok {
+			finish()
 		}
+
+		if d, ok := c.(deferredSource); ok {
+			var f func() error
+			f, err = d.loadDeferred(v, prov)
+			if f != nil {
+				deferred = append(deferred, f)
+			}
+		} else if o, ok := c.(originSource); ok {
+			err = o.loadOrigins(v, prov)
+		} else if t, ok := c.(tracker); ok && prov != nil {
+			err = t.track(v, prov)
+		} else {
+			err = c.Load(v)
+		}
+		errs.add(err)
 	}
-	return nil
+
+	finish()
+
+	errs.add(runHooks(v))
+
+	return errs.err()
 }
@@ -0,0 +1,192 @@
+// Package cli implements the configo command, which manages TOML config
+// files.
+//
+// Usage:
+//
+//	configo keygen
+//	configo encrypt [-key-file FILE] CONFIG KEY...
+//	configo rotate [-key-file FILE] -new-key-file FILE CONFIG
+//	configo migrate CONFIG...   (from Command.Run only)
+//
+// keygen prints a new base64 key. encrypt encrypts in place the values of
+// the given dotted keys, e.g. "db.password". rotate re-encrypts every
+// encrypted value with a new key. Without -key-file, the key is read from
+// CONFIGO_KEY or the file named by CONFIGO_KEY_FILE.
+//
+// migrate rewrites files in place to the latest layout version. Since
+// migrations are known to the program that knows the layout, programs with
+// migrations should offer the command by calling Command.Run from their own
+// binary, e.g. as a "config" subcommand. Run has no migrations, so its
+// migrate command fails.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/kimor79/configo"
+)
+
+const usage = `usage:
+  configo keygen
+  configo encrypt [-key-file FILE] CONFIG KEY...
+  configo rotate [-key-file FILE] -new-key-file FILE CONFIG
+`
+
+const migrateUsage = `  configo migrate CONFIG...
+`
+
+// Command is the configo command of a program.
+type Command struct {
+	// Migrations are applied by the migrate command.
+	Migrations *configo.Migrations
+}
+
+// Run runs the configo command without migrations, as the configo binary
+// does. See Command.Run.
+func Run(args []string, stdout, stderr io.Writer) int {
+	return Command{}.Run(args, stdout, stderr)
+}
+
+// Run runs the configo command with the arguments `args`, without the
+// program name, and returns its exit status.
+func (c Command) Run(args []string, stdout, stderr io.Writer) int {
+	usage := usage
+	if c.Migrations != nil {
+		usage += migrateUsage
+	}
+
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	var err error
+
+	switch args[0] {
+	case "keygen":
+		err = keygen(stdout)
+	case "encrypt":
+		err = encrypt(args[1:], stderr)
+	case "rotate":
+		err = rotate(args[1:], stderr)
+	case "migrate":
+		err = migrate(c.Migrations, args[1:], stdout)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "configo: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+
+	if err == flag.ErrHelp {
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "configo %s: %s\n", args[0], err)
+		return 1
+	}
+
+	return 0
+}
+
+func keygen(stdout io.Writer) error {
+	key, err := configo.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(stdout, key)
+	return err
+}
+
+func encrypt(args []string, stderr io.Writer) error {
+	fs := flag.NewFlagSet("encrypt", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	keyFile := fs.String("key-file", "", "file holding the base64 key")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() < 2 {
+		return fmt.Errorf("want a config file and at least one key")
+	}
+
+	key, err := readKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	return configo.EncryptFile(fs.Arg(0), key, fs.Args()[1:]...)
+}
+
+func rotate(args []string, stderr io.Writer) error {
+	fs := flag.NewFlagSet("rotate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	keyFile := fs.String("key-file", "", "file holding the current base64 key")
+	newKeyFile := fs.String("new-key-file", "", "file holding the new base64 key")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 || *newKeyFile == "" {
+		return fmt.Errorf("want -new-key-file and a config file")
+	}
+
+	oldKey, err := readKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	newKey, err := configo.KeyFromFile(*newKeyFile)()
+	if err != nil {
+		return err
+	}
+
+	return configo.RotateFile(fs.Arg(0), oldKey, newKey)
+}
+
+// readKey reads the key from `file`, or the default location if empty.
+func readKey(file string) ([]byte, error) {
+	if file == "" {
+		return configo.DefaultKey()
+	}
+
+	return configo.KeyFromFile(file)()
+}
+
+var errNoMigrations = errors.New("no migrations: run migrate from the program's own binary through cli.Command{Migrations: ...}.Run")
+
+func migrate(ms *configo.Migrations, args []string, stdout io.Writer) error {
+	if ms == nil {
+		return errNoMigrations
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("want at least one config file")
+	}
+
+	for _, file := range args {
+		from, to, err := ms.MigrateFile(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		if from == to {
+			fmt.Fprintf(stdout, "%s: version %d, up to date\n", file, from)
+			continue
+		}
+
+		fmt.Fprintf(stdout, "%s: migrated from version %d to %d\n", file, from, to)
+	}
+
+	return nil
+}
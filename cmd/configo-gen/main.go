@@ -0,0 +1,13 @@
+// Command configo-gen generates reflection-free loaders for config structs.
+// See package gen for usage.
+package main
+
+import (
+	"os"
+
+	"github.com/kimor79/configo/gen"
+)
+
+func main() {
+	os.Exit(gen.Run(os.Args[1:], os.Stdout, os.Stderr))
+}
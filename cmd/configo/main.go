@@ -0,0 +1,12 @@
+// Command configo manages TOML config files. See package cli for usage.
+package main
+
+import (
+	"os"
+
+	"github.com/kimor79/configo/cli"
+)
+
+func main() {
+	os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+}
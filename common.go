@@ -1,6 +1,8 @@
 package configo
 
 import (
+	"encoding"
+	"fmt"
 	"reflect"
 	"strconv"
 )
@@ -9,6 +11,14 @@ type Configo interface {
 	Load(interface{}) error
 }
 
+// Logger receives informational messages such as reload results.
+// *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// isZero reports whether `v` is unset. Nil slices and maps are unset, so a
+// TOML file leaving them out keeps the values already in the struct.
 func isZero(v reflect.Value) bool {
 	switch v.Kind() {
 	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.String:
@@ -21,67 +31,218 @@ func isZero(v reflect.Value) bool {
 		if v.Elem().Interface() == nil {
 			return true
 		}
+
+		return false
+	}
+
+	return v.IsZero()
+}
+
+// target returns the struct pointed to by `v`, or an error wrapping
+// ErrInvalidTarget if `v` is not a non-nil pointer to a struct.
+func target(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+
+	switch {
+	case rv.Kind() != reflect.Ptr:
+		return reflect.Value{}, fmt.Errorf("configo: cannot load into %T, want a pointer to a struct: %w", v, ErrInvalidTarget)
+	case rv.IsNil():
+		return reflect.Value{}, fmt.Errorf("configo: cannot load into a nil %T: %w", v, ErrInvalidTarget)
+	case rv.Elem().Kind() != reflect.Struct:
+		return reflect.Value{}, fmt.Errorf("configo: cannot load into %T, want a pointer to a struct: %w", v, ErrInvalidTarget)
+	}
+
+	return rv.Elem(), nil
+}
+
+// joinPath appends the field or key `name` to the dotted path `parent`.
+func joinPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+
+	return parent + "." + name
+}
+
+// isNested reports whether the field value `v` is a struct, or a pointer to
+// one, whose fields are walked rather than set as a whole.
+func isNested(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Struct:
+		return isStructType(v.Type())
+	case reflect.Ptr:
+		return v.Elem().Kind() == reflect.Struct && isStructType(v.Elem().Type())
 	}
 
 	return false
 }
 
+// set sets `v` from the string `s`. See converterFor.
 func set(v *reflect.Value, s string) error {
-	switch v.Kind() {
-	case reflect.Bool:
-		b, err := strconv.ParseBool(s)
-		if err != nil {
-			return err
+	conv := converterFor(v.Type())
+	if conv == nil {
+		return unsupported(v.Type())
+	}
+
+	return conv(*v, s)
+}
+
+// converter sets a value of the type it was made for from a string.
+type converter func(v reflect.Value, s string) error
+
+// converterFor returns the converter of type `t`, or nil if values of `t`
+// cannot be set from a string. Types implementing
+// encoding.TextUnmarshaler, directly or through a pointer, are set with
+// UnmarshalText; pointers are allocated when nil.
+func converterFor(t reflect.Type) converter {
+	if t.Kind() == reflect.Ptr {
+		if t.Implements(textUnmarshalerType) {
+			return func(v reflect.Value, s string) error {
+				if v.IsNil() {
+					v.Set(reflect.New(t.Elem()))
+				}
+
+				return v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+			}
 		}
 
-		v.SetBool(b)
-		return nil
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		if s == "" {
-			s = "0"
+		elem := converterFor(t.Elem())
+		if elem == nil {
+			return nil
 		}
 
-		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
-		if err != nil {
-			return err
+		return func(v reflect.Value, s string) error {
+			if v.IsNil() {
+				v.Set(reflect.New(t.Elem()))
+			}
+
+			return elem(v.Elem(), s)
 		}
+	}
 
-		v.SetInt(n)
-		return nil
-	case reflect.Ptr:
-		if !v.Elem().IsValid() {
-			v.Set(reflect.New(v.Type().Elem()))
+	kind := kindConverter(t)
+
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return func(v reflect.Value, s string) error {
+			if !v.CanAddr() {
+				if kind == nil {
+					return unsupported(t)
+				}
+
+				return kind(v, s)
+			}
+
+			return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
 		}
+	}
+
+	return kind
+}
 
-		switch v.Interface().(type) {
-		case *bool:
+// kindConverter returns the converter of type `t` based on its kind, or
+// nil if values of its kind cannot be set from a string.
+func kindConverter(t reflect.Type) converter {
+	switch t.Kind() {
+	case reflect.Bool:
+		return func(v reflect.Value, s string) error {
 			b, err := strconv.ParseBool(s)
 			if err != nil {
 				return err
 			}
 
-			v.Elem().SetBool(b)
+			v.SetBool(b)
 			return nil
-		case *int, *int8, *int16, *int32, *int64:
-			n, err := strconv.ParseInt(s, 10, v.Elem().Type().Bits())
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		bits := t.Bits()
+
+		return func(v reflect.Value, s string) error {
+			if s == "" {
+				s = "0"
+			}
+
+			n, err := strconv.ParseInt(s, 10, bits)
 			if err != nil {
 				return err
 			}
 
-			v.Elem().SetInt(n)
+			v.SetInt(n)
 			return nil
-		case *string:
-			v.Elem().SetString(s)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		bits := t.Bits()
+
+		return func(v reflect.Value, s string) error {
+			n, err := strconv.ParseUint(s, 10, bits)
+			if err != nil {
+				return err
+			}
+
+			v.SetUint(n)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		bits := t.Bits()
+
+		return func(v reflect.Value, s string) error {
+			f, err := strconv.ParseFloat(s, bits)
+			if err != nil {
+				return err
+			}
+
+			v.SetFloat(f)
 			return nil
-		default:
-			// TODO: Do something with unknown pointer types
 		}
 	case reflect.String:
-		v.SetString(s)
-		return nil
-	default:
-		// TODO: Do something with unknown reflect types
+		return func(v reflect.Value, s string) error {
+			v.SetString(s)
+			return nil
+		}
 	}
 
 	return nil
 }
+
+// stringKind tells how a field is set from a string, such as the value of
+// an environment variable or a "default" tag.
+type stringKind int
+
+const (
+	// fromString fields are converted by set.
+	fromString stringKind = iota
+	// ignoreString fields, slices and maps, are only read from files; their
+	// "env" and "default" tags are ignored.
+	ignoreString
+	// noString fields, such as channels, funcs, complex numbers and
+	// interfaces, cannot be set from a string.
+	noString
+)
+
+// stringKindOf returns how fields of type `t` are set from a string.
+func stringKindOf(t reflect.Type) stringKind {
+	if t.Implements(textUnmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return fromString
+	}
+
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fromString
+	case reflect.Ptr:
+		return stringKindOf(t.Elem())
+	case reflect.Slice, reflect.Map:
+		return ignoreString
+	}
+
+	return noString
+}
+
+// unsupported returns the error reported for a field of type `t` with an
+// "env" or "default" tag that cannot be set from a string.
+func unsupported(t reflect.Type) error {
+	return fmt.Errorf("%w %s", ErrUnsupportedType, t)
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
@@ -23,6 +23,15 @@
 //  // error check
 //
 //  fmt.Printf("Listening on port %d", *config.Port)
+//
+// Load returns a new config of a given type, with options selecting its
+// sources:
+//
+//  config, err := configo.Load[Config](
+//    configo.WithFile("/path/to/config.toml"),
+//    configo.WithProfile("prod"),
+//    configo.WithEnvPrefix("APP_"),
+//  )
 package configo
 
 // UnmarshalFile decodes the contents of the file `f` in TOML format into a pointer `v`. If `v` contains data, that data will be used as "defaults".
@@ -34,6 +43,8 @@ package configo
 // 3. If `v` already contains a value for the field, it will be used.
 // 4. If a "default" tag exists for a field, its value will be used, subject to type casting.
 // 5. The field will be initialized to its zero value (i.e., "" for string, 0 for int, etc).
+//
+// Once every field is set, `v` is checked against the rules in its "validate" tags (see Validate).
 func UnmarshalFile(f string, v interface{}) error {
 	var err error
 
@@ -41,6 +52,7 @@ func UnmarshalFile(f string, v interface{}) error {
 		NewDefaultsConfigo(),
 		NewTomlConfigo(f),
 		NewEnvConfigo(),
+		NewValidateConfigo(),
 	)
 
 	err = cc.Load(v)
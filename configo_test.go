@@ -1,10 +1,22 @@
 package configo
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/BurntSushi/toml"
+	"github.com/kimor79/configo/internal/tags/tagstest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -572,3 +584,2132 @@ func TestFromEnv(t *testing.T) {
 	assert.Equal(t, true, *got.StructPtr.TomlPtrBool)
 	assert.Equal(t, true, *got.StructPtr.EnvPtrBool)
 }
+
+func TestConfigoChainProvenance(t *testing.T) {
+	err := testUnsetEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = testSetEnv(map[string]string{"ENVINT": fmt.Sprintf("%d", testEnvInt)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testUnsetEnv()
+
+	got := Types{PassString: testPassString}
+	prov := Provenance{}
+
+	err = NewDefaultConfigoChain("testdata/types.toml").TrackProvenance(prov).Load(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, Origin{Source: "caller"}, prov["PassString"])
+	assert.Equal(t, Origin{Source: "default"}, prov["DefaultString"])
+	assert.Equal(t, Origin{Source: "toml", File: "testdata/types.toml", Line: 1}, prov["TomlString"])
+	assert.Equal(t, Origin{Source: "env", Var: "CONFIGO_TEST_ENVINT"}, prov["EnvInt"])
+	assert.Equal(t, "toml testdata/types.toml:1", prov["TomlString"].String())
+	assert.NotContains(t, prov, "ZeroString")
+}
+
+func TestUnmarshalFileLoadErrors(t *testing.T) {
+	err := testUnsetEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = testSetEnv(map[string]string{
+		"ENVINT":     "abc",
+		"ENVPTRINT":  "def",
+		"ENVPTRBOOL": "maybe",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testUnsetEnv()
+
+	var got SubTypes
+
+	err = UnmarshalFile("testdata/types.toml", &got)
+
+	var errs *LoadErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected *LoadErrors, got %v", err)
+	}
+
+	// Each bad variable is reported for SubTypes, Struct and StructPtr.
+	assert.Len(t, errs.Errs, 9)
+	assert.True(t, errors.Is(err, strconv.ErrSyntax))
+	assert.Contains(t, err.Error(), `env:CONFIGO_TEST_ENVINT Struct.EnvInt="abc"`)
+
+	var ferr *FieldError
+	if assert.True(t, errors.As(err, &ferr)) {
+		assert.Equal(t, "env:CONFIGO_TEST_ENVINT", ferr.Source)
+		assert.Equal(t, "abc", ferr.Value)
+	}
+	assert.Equal(t, 7878, got.TomlInt)
+}
+
+func TestFromTOMLFieldError(t *testing.T) {
+	var got SubTypes
+
+	err := FromTOML("testdata/bad_types.toml", &got)
+
+	var ferr *FieldError
+	if !errors.As(err, &ferr) {
+		t.Fatalf("expected *FieldError, got %v", err)
+	}
+
+	assert.Equal(t, "TomlInt", ferr.Path)
+	assert.Equal(t, "toml:testdata/bad_types.toml:2", ferr.Source)
+	assert.Equal(t, "not_an_int", ferr.Value)
+}
+
+func TestFromTOMLFieldErrors(t *testing.T) {
+	var got struct {
+		Alpha int `toml:"alpha"`
+		Zeta  int `toml:"zeta"`
+		DB    struct {
+			Port int `toml:"port"`
+		} `toml:"db"`
+	}
+
+	file := filepath.Join(t.TempDir(), "b.toml")
+
+	err := os.WriteFile(file, []byte("zeta = \"x\"\nalpha = \"y\"\n\n[db]\nport = true\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = FromTOML(file, &got)
+
+	var lerr *LoadErrors
+	if !assert.ErrorAs(t, err, &lerr) || !assert.Len(t, lerr.Errs, 3) {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		path, line, value, key string
+	}{
+		{"Zeta", "1", "x", "zeta"},
+		{"Alpha", "2", "y", "alpha"},
+		{"DB.Port", "5", "true", "db.port"},
+	}
+
+	for i, w := range want {
+		var ferr *FieldError
+		if !assert.ErrorAs(t, lerr.Errs[i], &ferr) {
+			continue
+		}
+
+		assert.Equal(t, w.path, ferr.Path)
+		assert.Equal(t, "toml:"+file+":"+w.line, ferr.Source)
+		assert.Equal(t, w.value, ferr.Value)
+
+		// The wrapped error is about the key of the field, not another
+		// key failing in the same file.
+		assert.Contains(t, ferr.Err.Error(), `"`+w.key+`"`)
+		for _, other := range want {
+			if other.key != w.key {
+				assert.NotContains(t, ferr.Err.Error(), `"`+other.key+`"`)
+			}
+		}
+	}
+}
+
+func TestFromTOMLFieldErrorQuotedKey(t *testing.T) {
+	var got SubTypes
+
+	file := filepath.Join(t.TempDir(), "quoted.toml")
+
+	err := os.WriteFile(file, []byte("[\"struct\"]\n\"TomlInt\" = \"x\"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = FromTOML(file, &got)
+
+	var ferr *FieldError
+	if !errors.As(err, &ferr) {
+		t.Fatalf("expected *FieldError, got %v", err)
+	}
+
+	assert.Equal(t, "Struct.TomlInt", ferr.Path)
+	assert.Equal(t, "toml:"+file+":2", ferr.Source)
+	assert.Equal(t, "x", ferr.Value)
+}
+
+func TestTomlPos(t *testing.T) {
+	assert.Equal(t, "app.toml:3", tomlPos("app.toml", 3))
+	assert.Equal(t, "app.toml", tomlPos("app.toml", 0))
+}
+
+type TestRules struct {
+	Dsn      *string `validate:"required"`
+	Port     int     `default:"0" validate:"min=1,max=65535"`
+	Mode     string  `default:"fast" validate:"oneof=fast|safe"`
+	Name     string  `default:"Bad Name" validate:"len=8,regexp=^[a-z]+$"`
+	Endpoint string  `default:"localhost" validate:"url"`
+	Listen   string  `default:"127.0.0.1:8080" validate:"hostport"`
+	Cert     string  `default:"testdata/types.toml" validate:"file_exists"`
+	Sub      struct {
+		Tags []string `validate:"min=1"`
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var got TestRules
+
+	err := FromDefaults(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Validate(&got)
+
+	var errs *LoadErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected *LoadErrors, got %v", err)
+	}
+
+	failed := map[string]string{}
+	for _, e := range errs.Errs {
+		var ferr *FieldError
+		var rerr *RuleError
+		if assert.True(t, errors.As(e, &ferr)) && assert.True(t, errors.As(e, &rerr)) {
+			failed[ferr.Path] = rerr.Rule
+		}
+	}
+
+	assert.Equal(t, map[string]string{
+		"Dsn":      "required",
+		"Port":     "min=1",
+		"Name":     "regexp=^[a-z]+$",
+		"Endpoint": "url",
+		"Sub.Tags": "min=1",
+	}, failed)
+}
+
+type TestHooksDB struct {
+	Host string `default:"db.local"`
+	Port int    `default:"5432"`
+	Dsn  string
+}
+
+func (db *TestHooksDB) AfterLoad() error {
+	db.Dsn = fmt.Sprintf("postgres://%s:%d", db.Host, db.Port)
+	return nil
+}
+
+type TestHooks struct {
+	DB      TestHooksDB
+	TLSCert string `default:"cert.pem"`
+	TLSKey  string
+	Order   []string
+}
+
+var errTestTLSKey = errors.New("TLSKey is required when TLSCert is set")
+
+func (h *TestHooks) AfterLoad() error {
+	h.Order = append(h.Order, h.DB.Dsn)
+	return nil
+}
+
+func (h TestHooks) Validate() error {
+	if h.TLSCert != "" && h.TLSKey == "" {
+		return errTestTLSKey
+	}
+
+	return nil
+}
+
+func TestConfigoChainHooks(t *testing.T) {
+	var got TestHooks
+
+	err := NewConfigoChain(NewDefaultsConfigo()).Load(&got)
+
+	assert.True(t, errors.Is(err, errTestTLSKey))
+
+	var ferr *FieldError
+	if assert.True(t, errors.As(err, &ferr)) {
+		assert.Equal(t, "", ferr.Path)
+		assert.Equal(t, "Validate", ferr.Source)
+	}
+
+	assert.Equal(t, "postgres://db.local:5432", got.DB.Dsn)
+	// Nested finalizers run before the struct containing them.
+	assert.Equal(t, []string{"postgres://db.local:5432"}, got.Order)
+}
+
+type testHookInner struct{ Name string }
+
+func (testHookInner) Validate() error { return errTestTLSKey }
+
+func TestConfigoChainHookFieldError(t *testing.T) {
+	var got struct{ Inner testHookInner }
+
+	err := NewConfigoChain().Load(&got)
+
+	var ferr *FieldError
+	if assert.True(t, errors.As(err, &ferr)) {
+		assert.Equal(t, "Inner", ferr.Path)
+		assert.Equal(t, "Validate", ferr.Source)
+		assert.True(t, errors.Is(err, errTestTLSKey))
+	}
+}
+
+func TestTomlConfigoStrict(t *testing.T) {
+	var got SubTypes
+
+	err := NewTomlConfigo("testdata/strict.toml").Strict().Load(&got)
+
+	var errs *LoadErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected *LoadErrors, got %v", err)
+	}
+
+	var keys []string
+	for _, e := range errs.Errs {
+		var kerr *UnknownKeyError
+		if assert.True(t, errors.As(e, &kerr)) {
+			assert.True(t, errors.Is(e, ErrUnknownKey))
+			keys = append(keys, kerr.Key+" "+kerr.Source)
+		}
+	}
+
+	assert.Equal(t, []string{
+		"tomlprot toml:testdata/strict.toml:2",
+		"struct.tomlsting toml:testdata/strict.toml:6",
+		"nosuchtable toml:testdata/strict.toml:8",
+	}, keys)
+
+	// Known keys are still applied.
+	assert.Equal(t, "toml_String", got.TomlString)
+}
+
+type TestEnvPrefix struct {
+	Port int `env:"PORT"`
+}
+
+func TestEnvConfigoStrict(t *testing.T) {
+	err := testUnsetEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = testSetEnv(map[string]string{
+		"PORT": "8080",
+		"PROT": "9090",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("CONFIGO_TEST_PORT")
+	defer os.Unsetenv("CONFIGO_TEST_PROT")
+
+	var got TestEnvPrefix
+
+	err = NewEnvConfigo().Strict().Load(&got)
+	assert.Error(t, err)
+	assert.Empty(t, got.Port)
+
+	err = NewEnvConfigo().Prefix("CONFIGO_TEST_").Strict().Load(&got)
+	assert.Equal(t, 8080, got.Port)
+
+	var errs *LoadErrors
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs.Errs, 1) {
+		assert.True(t, errors.Is(err, ErrUnknownKey))
+		assert.Equal(t, "env:CONFIGO_TEST_PROT CONFIGO_TEST_PROT: unknown key", err.Error())
+	}
+}
+
+type TestWatch struct {
+	Port int `default:"8080" validate:"max=65535"`
+}
+
+// testReplaceFile replaces `file` with `content` atomically, so a watcher
+// never reads it half-written.
+func testReplaceFile(t *testing.T, file, content string) {
+	t.Helper()
+
+	tmp := file + ".tmp"
+
+	err := os.WriteFile(tmp, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Rename(tmp, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testAwait calls `write` until `ch` receives, since a watcher started in
+// the background may miss the first write, and returns what it received.
+func testAwait[T any](t *testing.T, ch <-chan T, write func()) T {
+	t.Helper()
+
+	deadline := time.After(5 * time.Second)
+
+	for {
+		write()
+
+		select {
+		case v := <-ch:
+			return v
+		case <-time.After(200 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no notification")
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "watch.toml")
+
+	err := os.WriteFile(file, []byte("port = 1000\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWatcher[TestWatch](NewDefaultConfigoChain(file)).Debounce(10 * time.Millisecond).PollInterval(10 * time.Millisecond)
+
+	err = w.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 1000, w.Current().Port)
+
+	changes := make(chan [2]int, 1)
+	w.OnChange(func(old, new TestWatch) {
+		select {
+		case changes <- [2]int{old.Port, new.Port}:
+		default:
+		}
+	})
+
+	errs := make(chan error, 1)
+	w.OnError(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go w.Watch(ctx)
+
+	c := testAwait(t, changes, func() { testReplaceFile(t, file, "port = 2000\n") })
+	assert.Equal(t, [2]int{1000, 2000}, c)
+
+	// An invalid config is not published.
+	err = testAwait(t, errs, func() { testReplaceFile(t, file, "port = 70000\n") })
+	assert.True(t, errors.As(err, new(*RuleError)))
+
+	assert.Equal(t, 2000, w.Current().Port)
+}
+
+func TestWatcherCallbacksMayRegister(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "watch.toml")
+
+	err := os.WriteFile(file, []byte("port = 1000\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWatcher[TestWatch](NewDefaultConfigoChain(file))
+
+	registered := 0
+	w.OnChange(func(old, new TestWatch) {
+		registered++
+		w.OnChange(func(old, new TestWatch) {})
+		w.OnError(func(error) {})
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- w.Reload() }()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reload deadlocked")
+	}
+
+	assert.Equal(t, 1, registered)
+}
+
+type testLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.msgs = append(l.msgs, fmt.Sprintf(format, v...))
+}
+
+func (l *testLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return strings.Join(l.msgs, "\n")
+}
+
+func TestHolder(t *testing.T) {
+	h := NewHolder[TestWatch](nil)
+	assert.Nil(t, h.Get())
+
+	err := h.Load(NewConfigoChain(NewDefaultsConfigo()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := h.Get()
+	assert.Equal(t, 8080, first.Port)
+
+	err = h.Load(NewConfigoChain(NewDefaultsConfigo(), NewTomlConfigo("testdata/missing.toml")))
+	assert.Error(t, err)
+	assert.Same(t, first, h.Get())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			_ = h.Get().Port
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		h.Store(&TestWatch{Port: i})
+	}
+
+	<-done
+
+	assert.Equal(t, 99, h.Swap(first).Port)
+}
+
+func TestPoller(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "poll.toml")
+
+	p := newPoller([]string{file}, 10*time.Millisecond)
+	defer p.close()
+
+	err := os.WriteFile(file, []byte("port = 1000\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-p.events():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change event")
+	}
+}
+
+type TestDiffDB struct {
+	Host     string
+	Password string `secret:"true"`
+}
+
+type TestChanges struct {
+	Port    *int
+	DB      TestDiffDB
+	Replica *TestDiffDB
+	Hosts   []string
+	Labels  map[string]string
+	Same    string
+}
+
+func TestDiff(t *testing.T) {
+	oldPort, newPort := 80, 8080
+
+	a := TestChanges{
+		Port:   &oldPort,
+		DB:     TestDiffDB{Host: "a", Password: "old"},
+		Hosts:  []string{"h1", "h2"},
+		Labels: map[string]string{"env": "dev", "team": "x"},
+		Same:   "same",
+	}
+
+	b := TestChanges{
+		Port:    &newPort,
+		DB:      TestDiffDB{Host: "a", Password: "new"},
+		Replica: &TestDiffDB{Host: "r"},
+		Hosts:   []string{"h1", "h3", "h4"},
+		Labels:  map[string]string{"env": "prod", "tier": "web"},
+		Same:    "same",
+	}
+
+	assert.Equal(t, []Change{
+		{Path: "Port", Old: 80, New: 8080},
+		{Path: "DB.Password", Old: secretMask, New: secretMask},
+		{Path: "Replica.Host", Old: "", New: "r"},
+		{Path: "Hosts[1]", Old: "h2", New: "h3"},
+		{Path: "Hosts[2]", Old: nil, New: "h4"},
+		{Path: "Labels[env]", Old: "dev", New: "prod"},
+		{Path: "Labels[team]", Old: "x", New: nil},
+		{Path: "Labels[tier]", Old: nil, New: "web"},
+	}, Diff(&a, b))
+
+	assert.Empty(t, Diff(a, a))
+}
+
+func TestDiffMapKeys(t *testing.T) {
+	type config struct{ Weights map[interface{}]int }
+
+	a := config{Weights: map[interface{}]int{1: 1, "1": 2}}
+	b := config{Weights: map[interface{}]int{1: 1, "1": 3}}
+
+	assert.Equal(t, []Change{{Path: "Weights[1]", Old: 2, New: 3}}, Diff(a, b))
+	assert.Empty(t, Diff(a, a))
+}
+
+func TestMarshalTOML(t *testing.T) {
+	err := testUnsetEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = testSetEnv(map[string]string{"ENVINT": fmt.Sprintf("%d", testEnvInt)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testUnsetEnv()
+
+	var want SubTypes
+	prov := Provenance{}
+
+	err = NewDefaultConfigoChain("testdata/types.toml").TrackProvenance(prov).Load(&want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "out.toml")
+
+	err = WriteFile(file, &want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertMode := func(want os.FileMode) {
+		t.Helper()
+
+		fi, err := os.Stat(file)
+		if assert.NoError(t, err) {
+			assert.Equal(t, want, fi.Mode().Perm())
+		}
+	}
+
+	assertMode(0o644)
+
+	err = os.Chmod(file, 0o640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = WriteFile(file, &want)
+	assert.NoError(t, err)
+	assertMode(0o640)
+
+	// Revealed secrets are only readable by the owner.
+	err = WriteFile(file, &want, RevealSecrets())
+	assert.NoError(t, err)
+	assertMode(0o600)
+
+	var got SubTypes
+
+	err = FromTOML(file, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, want, got)
+
+	b, err := MarshalTOML(want, OmitDefaults(), AnnotateSources(prov))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := string(b)
+	assert.Contains(t, out, "TomlString = \"toml_String\" # toml testdata/types.toml:1\n")
+	assert.Contains(t, out, "EnvInt = 6789 # env CONFIGO_TEST_ENVINT\n")
+	assert.Contains(t, out, "\n[StructPtr]\n")
+	// Fields without a default are written even when zero.
+	assert.Contains(t, out, "ZeroInt = 0\n")
+
+	// StructPtr is allocated but not defaulted, see setDefaults.
+	root, _, _ := strings.Cut(out, "[StructPtr]")
+	assert.NotContains(t, root, "DefaultString")
+}
+
+func TestMarshalTOMLOmitDefaults(t *testing.T) {
+	v := struct {
+		Port  int    `default:"8080"`
+		Debug bool   `default:"true"`
+		Name  string `default:"app"`
+		Host  string `default:"localhost"`
+		Zero  int
+	}{Host: "localhost"}
+
+	b, err := MarshalTOML(v, OmitDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "Port = 0\nDebug = false\nName = \"\"\nZero = 0\n", string(b))
+}
+
+func TestMarshalTOMLTables(t *testing.T) {
+	type server struct {
+		Name string
+		Tags []string
+	}
+
+	v := struct {
+		Title   string `toml:"title"`
+		Skip    string `toml:"-"`
+		Ratio   float64
+		Labels  map[string]string
+		Servers []server
+	}{
+		Title:   "a \"quoted\"\ntitle",
+		Skip:    "skip",
+		Ratio:   2,
+		Labels:  map[string]string{"b": "2", "a.b": "1"},
+		Servers: []server{{Name: "s1", Tags: []string{"x"}}, {Name: "s2"}},
+	}
+
+	b, err := MarshalTOML(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, `title = "a \"quoted\"\ntitle"
+Ratio = 2.0
+
+[Labels]
+"a.b" = "1"
+b = "2"
+
+[[Servers]]
+Name = "s1"
+Tags = ["x"]
+
+[[Servers]]
+Name = "s2"
+Tags = []
+`, string(b))
+}
+
+type TestSampleDB struct {
+	Dsn  *string `desc:"Database connection string." env:"APP_DSN" validate:"required"`
+	Pool int     `default:"4"`
+}
+
+type TestSample struct {
+	Port    int    `toml:"port" default:"8080" env:"APP_PORT" desc:"Port to listen on."`
+	Name    string `default:"svc \"one\""`
+	Debug   bool   `default:"true"`
+	Hosts   []string
+	Secret  string       `toml:"-"`
+	DB      TestSampleDB `desc:"Primary database."`
+	Workers []TestSampleDB
+}
+
+func TestGenerateSample(t *testing.T) {
+	b, err := GenerateSample(&TestSample{}, SampleTOML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, `# Port to listen on.
+# env: APP_PORT
+port = 8080
+Name = "svc \"one\""
+Debug = true
+# Hosts = []
+
+# Primary database.
+[DB]
+# Database connection string.
+# env: APP_DSN
+# Dsn = ""
+Pool = 4
+
+[[Workers]]
+# Database connection string.
+# env: APP_DSN
+# Dsn = ""
+Pool = 4
+`, string(b))
+
+	var got TestSample
+
+	err = toml.Unmarshal(b, &got)
+	assert.NoError(t, err)
+
+	b, err = GenerateSample(TestSample{}, SampleYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, `# Port to listen on.
+# env: APP_PORT
+port: 8080
+Name: "svc \"one\""
+Debug: true
+# Hosts: []
+# Primary database.
+DB:
+  # Database connection string.
+  # env: APP_DSN
+  # Dsn: ""
+  Pool: 4
+Workers:
+  -
+    # Database connection string.
+    # env: APP_DSN
+    # Dsn: ""
+    Pool: 4
+`, string(b))
+}
+
+type TestSampleDefaults struct {
+	Ratio   float64       `toml:"ratio" default:"0.5"`
+	Scale   float32       `toml:"scale" default:"1.25"`
+	Count   uint          `toml:"count" default:"3"`
+	Port    uint16        `toml:"port" default:"8080"`
+	Offset  int8          `toml:"offset" default:"-2"`
+	Timeout time.Duration `toml:"timeout" default:"30"`
+	Verbose bool          `toml:"verbose" default:"true"`
+	Name    string        `toml:"name" default:"app"`
+}
+
+func TestGenerateSampleLoads(t *testing.T) {
+	b, err := GenerateSample(TestSampleDefaults{}, SampleTOML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, `ratio = 0.5
+scale = 1.25
+count = 3
+port = 8080
+offset = -2
+timeout = "30ns"
+verbose = true
+name = "app"
+`, string(b))
+
+	file := filepath.Join(t.TempDir(), "sample.toml")
+
+	err = os.WriteFile(file, b, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got TestSampleDefaults
+
+	err = UnmarshalFile(file, &got)
+	assert.NoError(t, err)
+	assert.Equal(t, TestSampleDefaults{Ratio: 0.5, Scale: 1.25, Count: 3, Port: 8080, Offset: -2, Timeout: 30, Verbose: true, Name: "app"}, got)
+}
+
+func TestDocument(t *testing.T) {
+	b, err := Document(TestSample{}, DocMarkdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "| Path | TOML key | Env | Type | Default | Required | Description |\n"+
+		"| --- | --- | --- | --- | --- | --- | --- |\n"+
+		"| `Port` | `port` | `APP_PORT` | `int` | `8080` |  | Port to listen on. |\n"+
+		"| `Name` | `Name` |  | `string` | `svc \"one\"` |  |  |\n"+
+		"| `Debug` | `Debug` |  | `bool` | `true` |  |  |\n"+
+		"| `Hosts` | `Hosts` |  | `[]string` |  |  |  |\n"+
+		"| `DB.Dsn` | `DB.Dsn` | `APP_DSN` | `string` |  | yes | Database connection string. |\n"+
+		"| `DB.Pool` | `DB.Pool` |  | `int` | `4` |  |  |\n"+
+		"| `Workers[].Dsn` | `Workers.Dsn` | `APP_DSN` | `string` |  | yes | Database connection string. |\n"+
+		"| `Workers[].Pool` | `Workers.Pool` |  | `int` | `4` |  |  |\n", string(b))
+
+	b, err = Document(&TestSample{}, DocHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(b), "<tr><td><code>Name</code></td><td><code>Name</code></td><td></td><td><code>string</code></td><td><code>svc &#34;one&#34;</code></td><td></td><td></td></tr>\n")
+}
+
+func TestJSONSchema(t *testing.T) {
+	b, err := JSONSchema(&TestRules{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+
+	err = json.Unmarshal(b, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "https://json-schema.org/draft/2020-12/schema", got["$schema"])
+	assert.Equal(t, "TestRules", got["title"])
+	assert.Equal(t, []interface{}{"Dsn"}, got["required"])
+
+	props := got["properties"].(map[string]interface{})
+
+	assert.Equal(t, map[string]interface{}{"type": "string"}, props["Dsn"])
+	assert.Equal(t, map[string]interface{}{"type": "integer", "default": 0.0, "minimum": 1.0, "maximum": 65535.0}, props["Port"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "default": "fast", "enum": []interface{}{"fast", "safe"}}, props["Mode"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "default": "Bad Name", "minLength": 8.0, "maxLength": 8.0, "pattern": "^[a-z]+$"}, props["Name"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "default": "localhost", "format": "uri"}, props["Endpoint"])
+	assert.Equal(t, map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"Tags": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "minItems": 1.0},
+		},
+		"additionalProperties": false,
+	}, props["Sub"])
+	assert.Equal(t, false, got["additionalProperties"])
+	assert.Equal(t, map[string]interface{}{"type": "integer", "minimum": 0.0, "description": "Layout version of the file."}, props[VersionKey])
+}
+
+type testSchemaNode struct {
+	Name     string
+	Children map[string]testSchemaNode
+	Next     *testSchemaNode
+}
+
+type testSchemaTree struct {
+	Root testSchemaNode
+	Up   *testSchemaTree
+}
+
+type testSchemaRequired struct {
+	File    string `validate:"required"`
+	Env     string `env:"APP_ENV" validate:"required"`
+	Alias   string `alias:"env:APP_ALIAS" validate:"required"`
+	Default string `default:"x" validate:"required"`
+	URL     string `alias:"db.dsn"`
+}
+
+func TestJSONSchemaRecursive(t *testing.T) {
+	b, err := JSONSchema(&testSchemaTree{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+
+	err = json.Unmarshal(b, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	props := got["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"$ref": "#"}, props["Up"])
+	assert.Equal(t, map[string]interface{}{"$ref": "#/$defs/configo.testSchemaNode"}, props["Root"])
+
+	node := got["$defs"].(map[string]interface{})["configo.testSchemaNode"].(map[string]interface{})
+	nodeProps := node["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"$ref": "#/$defs/configo.testSchemaNode"}, nodeProps["Next"])
+	assert.Equal(t, map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"$ref": "#/$defs/configo.testSchemaNode"},
+	}, nodeProps["Children"])
+}
+
+func TestJSONSchemaRequired(t *testing.T) {
+	b, err := JSONSchema(testSchemaRequired{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+
+	err = json.Unmarshal(b, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []interface{}{"File"}, got["required"])
+
+	props := got["properties"].(map[string]interface{})
+	db := props["db"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "string", "deprecated": true}, db["dsn"])
+}
+
+type TestSecrets struct {
+	User     string         `default:"admin"`
+	Password Secret[string] `default:"hunter2"`
+	Token    Secret[string] `env:"CONFIGO_TEST_TOKEN"`
+	Key      Secret[string] `toml:"key"`
+	Pin      int            `env:"CONFIGO_TEST_PIN" secret:"true"`
+}
+
+type testLevel int
+
+func (l *testLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = 1
+	case "info":
+		*l = 2
+	default:
+		return fmt.Errorf("unknown level %q", text)
+	}
+
+	return nil
+}
+
+type TestTextFields struct {
+	Level    testLevel  `default:"debug" env:"CONFIGO_TEST_LEVEL"`
+	LevelPtr *testLevel `default:"info"`
+	IP       net.IP     `default:"10.0.0.1"`
+	Bad      testLevel  `env:"CONFIGO_TEST_BAD_LEVEL"`
+}
+
+func TestTextUnmarshalerFields(t *testing.T) {
+	var got TestTextFields
+
+	err := FromDefaults(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, testLevel(1), got.Level)
+	assert.Equal(t, testLevel(2), *got.LevelPtr)
+	assert.Equal(t, "10.0.0.1", got.IP.String())
+
+	os.Setenv("CONFIGO_TEST_LEVEL", "info")
+	defer os.Unsetenv("CONFIGO_TEST_LEVEL")
+	os.Setenv("CONFIGO_TEST_BAD_LEVEL", "trace")
+	defer os.Unsetenv("CONFIGO_TEST_BAD_LEVEL")
+
+	err = FromEnv(&got)
+
+	var ferr *FieldError
+	if assert.True(t, errors.As(err, &ferr)) {
+		assert.Equal(t, "Bad", ferr.Path)
+		assert.Contains(t, ferr.Error(), `unknown level "trace"`)
+	}
+
+	assert.Equal(t, testLevel(2), got.Level)
+}
+
+type TestSecretRules struct {
+	Password Secret[string]  `validate:"min=4"`
+	Token    *Secret[string] `validate:"required,oneof=a|abcd"`
+}
+
+func TestValidateSecrets(t *testing.T) {
+	short := NewSecret("abcd")
+
+	err := Validate(&TestSecretRules{Password: NewSecret("abcd"), Token: &short})
+	assert.NoError(t, err)
+
+	err = Validate(&TestSecretRules{Password: NewSecret("abc")})
+
+	var errs *LoadErrors
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs.Errs, 2) {
+		assert.Contains(t, errs.Errs[0].Error(), "Password")
+		assert.True(t, errors.As(errs.Errs[0], new(*RuleError)))
+		assert.Contains(t, errs.Errs[1].Error(), "Token")
+		assert.NotContains(t, err.Error(), "abc\"")
+	}
+}
+
+func TestSecret(t *testing.T) {
+	os.Setenv("CONFIGO_TEST_TOKEN", "s3cr3t")
+	defer os.Unsetenv("CONFIGO_TEST_TOKEN")
+
+	file := filepath.Join(t.TempDir(), "secrets.toml")
+
+	err := os.WriteFile(file, []byte("key = \"k3y\"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got TestSecrets
+
+	err = NewDefaultConfigoChain(file).Load(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "hunter2", got.Password.Get())
+	assert.Equal(t, "s3cr3t", got.Token.Get())
+	assert.Equal(t, "k3y", got.Key.Get())
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		out := fmt.Sprintf(format, got)
+		assert.NotContains(t, out, "hunter2", format)
+		assert.NotContains(t, out, "s3cr3t", format)
+		assert.NotContains(t, out, "k3y", format)
+	}
+
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, string(b), "hunter2")
+
+	b, err = MarshalTOML(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(b), "Password = \""+secretMask+"\"\n")
+	assert.Contains(t, string(b), "Pin = \""+secretMask+"\"\n")
+
+	b, err = MarshalTOML(got, RevealSecrets())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(b), "Password = \"hunter2\"\n")
+
+	changed := got
+	changed.Token = NewSecret("other")
+	assert.Equal(t, []Change{{Path: "Token", Old: secretMask, New: secretMask}}, Diff(got, changed))
+
+	os.Setenv("CONFIGO_TEST_PIN", "12x4")
+	defer os.Unsetenv("CONFIGO_TEST_PIN")
+
+	err = FromEnv(&got)
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "12x4")
+		assert.Contains(t, err.Error(), "env:CONFIGO_TEST_PIN Pin=\""+secretMask+"\"")
+	}
+}
+
+type TestInterpDB struct {
+	Host     string         `toml:"host" default:"db.local"`
+	Port     int            `toml:"port" default:"3306"`
+	Password Secret[string] `toml:"password" env:"CONFIGO_TEST_DBPASS"`
+	DSN      Secret[string] `toml:"dsn"`
+}
+
+type TestInterp struct {
+	DB      TestInterpDB `toml:"db"`
+	Host    string       `toml:"host"`
+	User    *string      `toml:"user"`
+	Home    string       `toml:"home"`
+	Escaped string       `toml:"escaped"`
+	URL     string       `toml:"url"`
+	Default string       `toml:"default" default:"${HOME}"`
+	Env     string       `toml:"env" env:"CONFIGO_TEST_INTERP_ENV"`
+	Caller  string       `toml:"caller"`
+}
+
+func TestInterpolate(t *testing.T) {
+	os.Setenv("CONFIGO_TEST_DBPASS", "pw")
+	defer os.Unsetenv("CONFIGO_TEST_DBPASS")
+	os.Setenv("CONFIGO_TEST_INTERP_ENV", "${HOME}")
+	defer os.Unsetenv("CONFIGO_TEST_INTERP_ENV")
+
+	file := filepath.Join(t.TempDir(), "interp.toml")
+
+	err := os.WriteFile(file, []byte(`host = "web.local"
+user = "${CONFIGO_TEST_USER:-nobody}"
+home = "${CONFIGO_TEST_UNSET:-}/home"
+escaped = "$${HOME}"
+url = "http://${.db.host}:${.db.port}/${.host}"
+
+[db]
+dsn = "app:${.db.password}@tcp(${.DB.Host}:${.db.port})/app"
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got TestInterp
+
+	err = UnmarshalFile(file, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "${CONFIGO_TEST_USER:-nobody}", *got.User, "interpolation is opt-in")
+
+	got = TestInterp{Caller: "${HOME}"}
+
+	err = NewConfigoChain(
+		NewDefaultsConfigo(),
+		NewTomlConfigo(file),
+		NewEnvConfigo(),
+		NewInterpolateConfigo(),
+	).Load(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load[TestInterp](WithFile(file), WithInterpolation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "nobody", *loaded.User)
+
+	assert.Equal(t, "app:pw@tcp(db.local:3306)/app", got.DB.DSN.Get())
+	assert.Equal(t, "nobody", *got.User)
+	assert.Equal(t, "/home", got.Home)
+	assert.Equal(t, "${HOME}", got.Escaped)
+	assert.Equal(t, "http://db.local:3306/web.local", got.URL)
+	assert.Equal(t, "${HOME}", got.Default, "defaults are not expanded")
+	assert.Equal(t, "${HOME}", got.Env, "environment variables are not expanded")
+	assert.Equal(t, "${HOME}", got.Caller, "values set by the caller are not expanded")
+
+	type cycleX struct {
+		C string `toml:"c"`
+		D string `toml:"d"`
+	}
+
+	type cycle struct {
+		B       cycleX `toml:"x"`
+		Missing string
+		Unset   string
+		Open    string
+		NoDot   string
+	}
+
+	bad := cycle{
+		B:       cycleX{C: "${.x.d}", D: "${.x.c}"},
+		Missing: "${.nosuch.key}",
+		Unset:   "${CONFIGO_TEST_UNSET}",
+		Open:    "${CONFIGO_TEST_UNSET",
+		NoDot:   "pg://${x.c:-}",
+	}
+
+	err = Interpolate(&bad)
+
+	var errs *LoadErrors
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs.Errs, 6) {
+		assert.Contains(t, errs.Errs[0].Error(), "B.D=\"${.x.c}\": reference cycle x.c -> x.d -> x.c")
+		assert.True(t, errors.Is(errs.Errs[2], ErrUnknownKey))
+		assert.Contains(t, errs.Errs[3].Error(), "variable not set")
+		assert.Contains(t, errs.Errs[4].Error(), "unterminated reference")
+		assert.Contains(t, errs.Errs[5].Error(), "${x.c:-}: variable not set; use ${.x.c:-} to refer to the config key")
+	}
+}
+
+type TestDerivedDB struct {
+	Host string `default:"localhost"`
+	Port int    `default:"3306"`
+	Addr string `default:"${.Host}:${.Port}"`
+}
+
+type TestDerived struct {
+	DataDir  string  `toml:"data_dir" default:"/var/lib/app"`
+	CacheDir *string `default:"{{.DataDir}}/cache"`
+	TmpDir   string  `default:"${.CacheDir}/tmp"`
+	LogFile  string  `default:"${.LogDir:-/var/log}/app.log"`
+	LogDir   string
+	DB       TestDerivedDB `toml:"db"`
+	DSN      string        `default:"tcp(${.DB.Addr})/${DBNAME}"`
+}
+
+func TestFieldByPath(t *testing.T) {
+	typ := reflect.TypeOf(tagstest.Fields{})
+
+	for path, want := range tagstest.FieldPaths {
+		_, ok := fieldByPath(typ, path)
+		assert.Equal(t, want, ok, path)
+	}
+}
+
+func TestDerivedDefaults(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "derived.toml")
+
+	err := os.WriteFile(file, []byte("data_dir = \"/data\"\n[db]\nhost = \"db1\"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := TestDerived{TmpDir: "/tmp"}
+	prov := Provenance{}
+
+	err = NewDefaultConfigoChain(file).TrackProvenance(prov).Load(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "/data/cache", *got.CacheDir)
+	assert.Equal(t, "/tmp", got.TmpDir)
+	assert.Equal(t, "/var/log/app.log", got.LogFile)
+	assert.Equal(t, "db1:3306", got.DB.Addr)
+	assert.Equal(t, "tcp(db1:3306)/${DBNAME}", got.DSN, "only ${.Field} references are derived")
+	assert.Equal(t, "default", prov["DB.Addr"].Source)
+	assert.Equal(t, "default", prov["DSN"].Source)
+
+	var defaults TestDerived
+
+	err = FromDefaults(&defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "/var/lib/app/cache/tmp", defaults.TmpDir)
+	assert.Equal(t, "tcp(localhost:3306)/${DBNAME}", defaults.DSN)
+
+	type cycle struct {
+		A string `default:"${.B}"`
+		B string `default:"{{.A}}"`
+		C string `default:"{{.Nope}}"`
+		D string `default:"${.Nope}"`
+	}
+
+	err = FromDefaults(&cycle{})
+
+	var errs *LoadErrors
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs.Errs, 4) {
+		assert.Contains(t, errs.Errs[0].Error(), "D=\"${.Nope}\": default refers to an unknown field Nope")
+		assert.Contains(t, errs.Errs[1].Error(), "A=\"${.B}\": default depends on itself")
+		assert.Contains(t, errs.Errs[2].Error(), "B=\"{{.A}}\": default depends on itself")
+		assert.Contains(t, errs.Errs[3].Error(), "can't evaluate field Nope")
+	}
+
+	b, err := GenerateSample(TestDerived{}, SampleTOML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(b), "# CacheDir = \"{{.DataDir}}/cache\"\n")
+}
+
+func TestDerivedBareRef(t *testing.T) {
+	var got struct {
+		Host string `default:"localhost"`
+		Port int    `default:"5432"`
+		Addr string `default:"${Host}:${Port}"`
+		Home string `default:"${HOME_DIR}/app"`
+	}
+
+	err := FromDefaults(&got)
+
+	var ferr *FieldError
+	if assert.ErrorAs(t, err, &ferr) {
+		assert.Equal(t, "Addr", ferr.Path)
+		assert.EqualError(t, ferr.Err, "default refers to a field without the leading dot: use ${.Host}")
+	}
+
+	assert.Empty(t, got.Addr)
+	assert.Equal(t, "${HOME_DIR}/app", got.Home, "references to no field are kept")
+}
+
+type TestResolve struct {
+	Password Secret[string] `toml:"password"`
+	Token    *string        `toml:"token" secret:"true"`
+	Key      string         `toml:"key" secret:"true"`
+	URL      string         `toml:"url" secret:"true"`
+	Dir      string         `toml:"dir"`
+	Missing  string         `toml:"missing" secret:"true"`
+}
+
+func TestResolveConfigo(t *testing.T) {
+	dir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(dir, "key"), []byte("k3y\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("CONFIGO_TEST_TOKEN", "t0ken")
+	defer os.Unsetenv("CONFIGO_TEST_TOKEN")
+
+	file := filepath.Join(dir, "resolve.toml")
+
+	err = os.WriteFile(file, []byte(`password = "vault://db/password"
+token = "env://CONFIGO_TEST_TOKEN"
+key = "file://`+filepath.ToSlash(filepath.Join(dir, "key"))+`"
+url = "https://example.com"
+dir = "file:///var/lib/app"
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vault := MapResolver{"db/password": "hunter2"}
+
+	var got TestResolve
+
+	err = NewConfigoChain(NewTomlConfigo(file), NewResolveConfigo().With("Vault", vault)).Load(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "hunter2", got.Password.Get())
+	assert.Equal(t, "t0ken", *got.Token)
+	assert.Equal(t, "k3y", got.Key)
+	assert.Equal(t, "https://example.com", got.URL)
+	assert.Equal(t, "file:///var/lib/app", got.Dir, "fields that are not secret are not resolved")
+
+	RegisterSecretResolver("TEST", SecretResolverFunc(func(ref string) (string, error) {
+		return "", fmt.Errorf("no secret %s", ref)
+	}))
+	defer RegisterSecretResolver("test", nil)
+
+	got = TestResolve{Key: "vault://nosuch", Missing: "test://oops"}
+
+	err = NewResolveConfigo().Load(&got)
+
+	var errs *LoadErrors
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs.Errs, 1) {
+		assert.Equal(t, `resolve:test Missing="******": no secret oops`, err.Error())
+	}
+
+	assert.Equal(t, "vault://nosuch", got.Key)
+}
+
+type TestEncryptedDB struct {
+	Password string `toml:"password"`
+	Port     int    `toml:"port"`
+}
+
+type TestEncrypted struct {
+	Name string          `toml:"name"`
+	DB   TestEncryptedDB `toml:"db"`
+}
+
+func TestEncryptedValues(t *testing.T) {
+	dir := t.TempDir()
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := filepath.Join(dir, "key")
+
+	err = os.WriteFile(keyFile, []byte(key+"\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := KeyFromFile(keyFile)()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "config.toml")
+
+	err = os.WriteFile(file, []byte("name = \"app\"\n\n[db]\npassword = \"hunter2\" # rotated yearly\nport = 3306\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = EncryptFile(file, k, "db.password", "DB.Port")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := string(b)
+	assert.NotContains(t, out, "hunter2")
+	assert.NotContains(t, out, "3306")
+	assert.Contains(t, out, "password = \"ENC[AES256_GCM,data:")
+	assert.Contains(t, out, ",type:int]\"\n")
+	assert.Contains(t, out, "]\" # rotated yearly\n")
+
+	var got TestEncrypted
+
+	prov := Provenance{}
+
+	err = NewConfigoChain(NewTomlConfigo(file).Key(KeyFromFile(keyFile))).TrackProvenance(prov).Load(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, TestEncrypted{Name: "app", DB: TestEncryptedDB{Password: "hunter2", Port: 3306}}, got)
+	assert.Equal(t, 4, prov["DB.Password"].Line)
+
+	newKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nk, err := decodeKey(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = RotateFile(file, k, nk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv(KeyEnv, newKey)
+	defer os.Unsetenv(KeyEnv)
+
+	got = TestEncrypted{}
+
+	err = FromTOML(file, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "hunter2", got.DB.Password)
+
+	err = NewTomlConfigo(file).Key(KeyFromFile(keyFile)).Load(&got)
+
+	var ferr *FieldError
+	if assert.True(t, errors.As(err, &ferr)) {
+		assert.Equal(t, "DB.Password", ferr.Path)
+		assert.Equal(t, fmt.Sprintf("toml:%s:4", file), ferr.Source)
+		assert.Contains(t, err.Error(), "wrong key")
+	}
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, entries, 2, "no temporary file is left")
+
+	enc, err := Encrypt(nk, "db.password", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Encrypted values in comments and multi-line strings are not values.
+	err = os.WriteFile(file, []byte("# old = \""+enc+"\"\nname = \"\"\"\n"+enc+"\"\"\"\n[db]\npassword = \""+enc+"\"\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got = TestEncrypted{}
+
+	err = FromTOML(file, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, enc, got.Name)
+	assert.Equal(t, "hunter2", got.DB.Password)
+
+	// A value copied to another key does not decrypt.
+	err = os.WriteFile(file, []byte("name = \""+enc+"\"\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = FromTOML(file, &TestEncrypted{})
+	if assert.True(t, errors.As(err, &ferr)) {
+		assert.Equal(t, "Name", ferr.Path)
+		assert.Contains(t, err.Error(), "moved from another key")
+	}
+
+	err = os.WriteFile(file, []byte("[db]\npassword = \"hunter2\"\nport = 3306\nname = { first = \"x\" }\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = EncryptFile(file, nk, "db.name.first")
+	assert.ErrorContains(t, err, "db.name.first: only single-line values outside arrays and inline tables can be encrypted")
+}
+
+type TestAliasDatabase struct {
+	URL    string `toml:"url" env:"CONFIGO_TEST_DATABASE_URL" alias:"mysql.dsn,env:CONFIGO_TEST_MYSQL_DSN"`
+	Legacy string `toml:"legacy" alias:"toml:OLD_LEGACY"`
+}
+
+type TestAlias struct {
+	Database TestAliasDatabase `toml:"database"`
+	Workers  int               `toml:"workers" env:"CONFIGO_TEST_WORKERS" deprecated:"workers are sized automatically"`
+}
+
+func TestAliases(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "alias.toml")
+
+	err := os.WriteFile(file, []byte("OLD_LEGACY = \"x\"\nworkers = 4\n\n[mysql]\ndsn = \"mysql://old\"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got TestAlias
+	var logger testLogger
+	prov := Provenance{}
+
+	err = NewConfigoChain(NewTomlConfigo(file).Strict()).Logger(&logger).TrackProvenance(prov).Load(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, TestAlias{Database: TestAliasDatabase{URL: "mysql://old", Legacy: "x"}, Workers: 4}, got)
+	assert.Equal(t, 5, prov["Database.URL"].Line)
+	assert.Equal(t, fmt.Sprintf(`configo: key "mysql.dsn" in %s:5 is deprecated, use "database.url"`+"\n"+
+		`configo: key "OLD_LEGACY" in %s:1 is deprecated, use "database.legacy"`+"\n"+
+		`configo: key "workers" in %s:2 is deprecated: workers are sized automatically`, file, file, file), logger.String())
+
+	os.Setenv("CONFIGO_TEST_MYSQL_DSN", "mysql://env")
+	defer os.Unsetenv("CONFIGO_TEST_MYSQL_DSN")
+
+	logger = testLogger{}
+	got = TestAlias{}
+
+	err = NewEnvConfigo().Logger(&logger).Load(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "mysql://env", got.Database.URL)
+	assert.Equal(t, "configo: environment variable CONFIGO_TEST_MYSQL_DSN is deprecated, use CONFIGO_TEST_DATABASE_URL", logger.String())
+
+	os.Setenv("CONFIGO_TEST_DATABASE_URL", "mysql://new")
+	defer os.Unsetenv("CONFIGO_TEST_DATABASE_URL")
+
+	logger = testLogger{}
+
+	err = NewEnvConfigo().Logger(&logger).Load(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "mysql://new", got.Database.URL)
+	assert.Contains(t, logger.String(), "CONFIGO_TEST_MYSQL_DSN is ignored since CONFIGO_TEST_DATABASE_URL is set")
+}
+
+func TestInvalidAliases(t *testing.T) {
+	var got struct {
+		DSN  string `toml:"dsn" alias:"mysql.dsn,MYSQL_DSN"`
+		Port int    `toml:"port" alias:"toml:PORT,old port,env:"`
+	}
+
+	file := filepath.Join(t.TempDir(), "alias.toml")
+
+	err := os.WriteFile(file, []byte("[mysql]\ndsn = \"mysql://old\"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("MYSQL_DSN", "mysql://env")
+
+	err = NewConfigoChain(NewTomlConfigo(file), NewEnvConfigo()).Load(&got)
+
+	var lerr *LoadErrors
+	if assert.ErrorAs(t, err, &lerr) {
+		assert.Len(t, lerr.Errs, 2)
+	}
+
+	assert.ErrorIs(t, err, ErrInvalidAlias)
+	assert.Contains(t, err.Error(), `alias DSN="mysql.dsn,MYSQL_DSN": invalid alias "MYSQL_DSN": prefix it with "env:"`)
+	assert.Contains(t, err.Error(), `alias Port="toml:PORT,old port,env:": invalid alias`)
+
+	// The valid aliases are still read.
+	assert.Equal(t, "mysql://old", got.DSN)
+}
+
+type TestMigrate struct {
+	Database struct {
+		URL string `toml:"url"`
+	} `toml:"database"`
+	Workers int `toml:"workers"`
+}
+
+func TestMigrations(t *testing.T) {
+	ms := NewMigrations().
+		Add(0, 101, func(doc map[string]interface{}) error {
+			return errors.New("unversioned")
+		}).
+		Add(101, 102, func(doc map[string]interface{}) error {
+			mysql, _ := doc["mysql"].(map[string]interface{})
+			doc["database"] = map[string]interface{}{"url": mysql["dsn"]}
+			delete(doc, "mysql")
+			return nil
+		}).
+		Add(102, 103, func(doc map[string]interface{}) error {
+			doc["workers"] = doc["threads"]
+			delete(doc, "threads")
+			return nil
+		})
+
+	file := filepath.Join(t.TempDir(), "migrate.toml")
+
+	err := os.WriteFile(file, []byte("version = 101\nthreads = 8\n\n[mysql]\ndsn = \"mysql://db\"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got TestMigrate
+	prov := Provenance{}
+
+	err = NewConfigoChain(NewTomlConfigo(file).Strict().Migrations(ms)).TrackProvenance(prov).Load(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "mysql://db", got.Database.URL)
+	assert.Equal(t, 8, got.Workers)
+	assert.Equal(t, Origin{Source: "toml", File: file}, prov["Workers"])
+
+	// Files of other TomlConfigos are not migrated.
+	err = FromTOML(file, &TestMigrate{})
+	assert.NoError(t, err)
+
+	loaded, err := Load[TestMigrate](WithFile(file), WithMigrations(ms))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 8, loaded.Workers)
+
+	from, to, err := ms.MigrateFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 101, from)
+	assert.Equal(t, 103, to)
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(b), "version = 103\n")
+	assert.Contains(t, string(b), "\n[database]\nurl = \"mysql://db\"\n")
+	assert.NotContains(t, string(b), "[mysql]")
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+
+	from, to, err = ms.MigrateFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, 103, from)
+	assert.Equal(t, 103, to)
+
+	_, _, err = ms.Migrate(map[string]interface{}{})
+	assert.EqualError(t, err, "migrating from version 0 to 101: unversioned")
+
+	from, to, err = (*Migrations)(nil).MigrateFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, 103, to)
+
+	assert.Panics(t, func() { ms.Add(101, 104, nil) })
+	assert.Panics(t, func() { ms.Add(200, 199, nil) })
+}
+
+func TestMigrateEncrypted(t *testing.T) {
+	ms := NewMigrations().Add(0, 1, func(doc map[string]interface{}) error {
+		mysql, _ := doc["mysql"].(map[string]interface{})
+		doc["database"] = map[string]interface{}{"url": mysql["dsn"]}
+		delete(doc, "mysql")
+		return nil
+	})
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := decodeKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "migrate.toml")
+
+	err = os.WriteFile(file, []byte("workers = 2\n\n[mysql]\ndsn = \"mysql://db\"\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = EncryptFile(file, k, "mysql.dsn")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from, to, err := ms.MigrateFile(file)
+	assert.ErrorIs(t, err, ErrEncryptedMigration)
+	assert.Equal(t, 0, from)
+	assert.Equal(t, 1, to)
+
+	after, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(before), string(after))
+
+	// The file is still migrated as it is loaded.
+	var got TestMigrate
+	err = NewConfigoChain(NewTomlConfigo(file).Migrations(ms).Key(func() ([]byte, error) { return k, nil })).Load(&got)
+	assert.NoError(t, err)
+	assert.Equal(t, "mysql://db", got.Database.URL)
+	assert.Equal(t, 2, got.Workers)
+}
+
+type TestLoad struct {
+	Host    string `toml:"host" default:"localhost"`
+	Port    int    `toml:"port" env:"PORT" default:"8080" validate:"max=65535"`
+	Debug   bool   `toml:"debug"`
+	Workers int    `toml:"workers" default:"1"`
+}
+
+func TestLoadGeneric(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.toml")
+
+	err := os.WriteFile(file, []byte("host = \"example.com\"\ndebug = true\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "config.prod.toml"), []byte("host = \"prod.example.com\"\nworkers = 8\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("CONFIGO_TEST_LOAD_PORT", "9090")
+	defer os.Unsetenv("CONFIGO_TEST_LOAD_PORT")
+
+	prov := Provenance{}
+
+	got, err := Load[TestLoad](
+		WithFile(file),
+		WithProfile("prod"),
+		WithEnvPrefix("CONFIGO_TEST_LOAD_"),
+		WithStrict(),
+		WithProvenance(prov),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &TestLoad{Host: "prod.example.com", Port: 9090, Debug: true, Workers: 8}, got)
+	assert.Equal(t, filepath.Join(dir, "config.prod.toml"), prov["Host"].File)
+
+	got, err = Load[TestLoad](WithFile(file), WithProfile("staging"), WithoutEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &TestLoad{Host: "example.com", Port: 8080, Debug: true, Workers: 1}, got)
+
+	os.Setenv("CONFIGO_TEST_LOAD_PORT", "99999")
+
+	_, err = Load[TestLoad](WithEnvPrefix("CONFIGO_TEST_LOAD_"))
+	assert.True(t, errors.As(err, new(*RuleError)))
+
+	got, err = Load[TestLoad](WithEnvPrefix("CONFIGO_TEST_LOAD_"), WithoutValidation())
+	if assert.NoError(t, err) {
+		assert.Equal(t, 99999, got.Port)
+	}
+
+	_, err = Load[TestLoad](WithFile(filepath.Join(dir, "missing.toml")))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	_, err = Load[int]()
+	assert.True(t, errors.Is(err, ErrInvalidTarget))
+
+	// Overlays apply zero values too.
+	err = os.WriteFile(filepath.Join(dir, "config.dev.toml"), []byte("host = \"\"\ndebug = false\nworkers = 0\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = Load[TestLoad](WithFile(file), WithProfile("dev"), WithoutEnv(), WithProvenance(prov))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &TestLoad{Host: "", Port: 8080, Debug: false, Workers: 0}, got)
+	assert.Equal(t, filepath.Join(dir, "config.dev.toml"), prov["Workers"].File)
+
+	// Without a prefix only files are strict.
+	os.Unsetenv("CONFIGO_TEST_LOAD_PORT")
+
+	_, err = Load[TestLoad](WithFile(file), WithStrict())
+	assert.NoError(t, err)
+}
+
+type TestUnsupported struct {
+	Ch    chan int    `default:"1"`
+	Fn    func()      `env:"CONFIGO_TEST_FN"`
+	C     complex128  `default:"1"`
+	I     interface{} `default:"x"`
+	Ratio float64     `default:"0.5"`
+	Size  uint16      `default:"512"`
+	Skip  chan int
+	Tags  []string `env:"CONFIGO_TEST_TAGS" default:"a"`
+	Addr  net.IP   `env:"CONFIGO_TEST_ADDR"`
+}
+
+func TestInvalidTargets(t *testing.T) {
+	var cfg TestLoad
+	var nilCfg *TestLoad
+	var n int
+
+	for name, fn := range map[string]func() error{
+		"FromDefaults value": func() error { return FromDefaults(cfg) },
+		"FromEnv nil":        func() error { return FromEnv(nilCfg) },
+		"FromTOML int":       func() error { return FromTOML("testdata/types.toml", &n) },
+		"UnmarshalFile nil":  func() error { return UnmarshalFile("testdata/types.toml", nil) },
+		"Validate value":     func() error { return Validate(cfg) },
+		"Interpolate nil":    func() error { return Interpolate(nilCfg) },
+	} {
+		assert.True(t, errors.Is(fn(), ErrInvalidTarget), name)
+	}
+
+	// Unsupported types are reported even if no value is set, while the
+	// "env" and "default" tags of slices and maps are ignored.
+	os.Setenv("CONFIGO_TEST_TAGS", "x,y")
+	defer os.Unsetenv("CONFIGO_TEST_TAGS")
+	os.Setenv("CONFIGO_TEST_ADDR", "10.0.0.1")
+	defer os.Unsetenv("CONFIGO_TEST_ADDR")
+
+	var got TestUnsupported
+
+	err := NewConfigoChain(NewDefaultsConfigo(), NewEnvConfigo()).Load(&got)
+
+	var paths []string
+	var errs *LoadErrors
+	if assert.True(t, errors.As(err, &errs)) {
+		for _, e := range errs.Errs {
+			var ferr *FieldError
+			if assert.True(t, errors.As(e, &ferr)) && assert.True(t, errors.Is(e, ErrUnsupportedType)) {
+				paths = append(paths, ferr.Path)
+			}
+		}
+	}
+
+	assert.Equal(t, []string{"Ch", "C", "I", "Fn"}, paths)
+	assert.Contains(t, err.Error(), "default Ch=\"1\": unsupported type chan int")
+	assert.Equal(t, 0.5, got.Ratio)
+	assert.Equal(t, uint16(512), got.Size)
+	assert.Nil(t, got.Tags)
+	assert.Equal(t, "10.0.0.1", got.Addr.String())
+}
+
+func TestTomlKeepsStructPointers(t *testing.T) {
+	got := SubTypes{StructPtr: &Types{TomlString: "keep"}}
+
+	file := filepath.Join(t.TempDir(), "partial.toml")
+
+	err := os.WriteFile(file, []byte("TomlString = \"set\"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = FromTOML(file, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "set", got.TomlString)
+	assert.Equal(t, "keep", got.StructPtr.TomlString)
+}
+
+func TestTomlKeepsNilSlicesAndMaps(t *testing.T) {
+	type config struct {
+		Name   string
+		Tags   []string
+		Labels map[string]string
+	}
+
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "partial.toml")
+	err := os.WriteFile(file, []byte("name = \"app\"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := config{Tags: []string{"keep"}, Labels: map[string]string{"k": "keep"}}
+
+	err = FromTOML(file, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, config{Name: "app", Tags: []string{"keep"}, Labels: map[string]string{"k": "keep"}}, got)
+
+	file = filepath.Join(dir, "full.toml")
+	err = os.WriteFile(file, []byte("tags = [\"set\"]\n\n[labels]\nk = \"set\"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = FromTOML(file, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, config{Name: "app", Tags: []string{"set"}, Labels: map[string]string{"k": "set"}}, got)
+}
+
+func TestTomlKeyLines(t *testing.T) {
+	lines := tomlKeyLines([]byte(`# [commented.out]
+name = "app" # not a [table]
+"a=b" = 1
+db = { host = "db1", port = 5432 }
+
+[server] # ]
+port = 80
+motd = """
+x = 1
+"""
+
+[[listen]]
+addr = ":80"
+`))
+
+	assert.Equal(t, map[string]int{
+		"name":        2,
+		"a=b":         3,
+		"db":          4,
+		"db.host":     4,
+		"db.port":     4,
+		"server":      6,
+		"server.port": 7,
+		"server.motd": 8,
+		"listen":      12,
+		"listen.addr": 13,
+	}, lines)
+
+	assert.Empty(t, tomlKeyLines([]byte("not toml")))
+}
+
+func TestPlanFor(t *testing.T) {
+	type T struct {
+		hidden string
+		Name   string  `toml:"Display_Name" env:"NAME" alias:"old.name,env:OLD_NAME" default:"x" secret:"true" validate:"required"`
+		Full   string  `default:"{{.Name}}-full"`
+		DB     BenchDB `toml:"db"`
+	}
+
+	typ := reflect.TypeOf(T{})
+	plan := planFor(typ)
+
+	assert.Same(t, plan, planFor(typ))
+
+	if assert.Len(t, plan.fields, 3) {
+		name := plan.fields[0]
+		assert.Equal(t, 1, name.index)
+		assert.Equal(t, "display_name", name.tomlKey)
+		assert.Equal(t, "NAME", name.env)
+		assert.Equal(t, []string{"OLD_NAME"}, name.envAliases)
+		assert.True(t, name.secret)
+		assert.False(t, name.derived)
+		assert.Len(t, name.rules, 1)
+		assert.NotNil(t, name.conv)
+
+		assert.True(t, plan.fields[1].derived)
+		assert.True(t, plan.fields[2].structType)
+	}
+}
+
+type BenchDB struct {
+	Host     string `toml:"host" env:"BENCH_DB_HOST" default:"localhost" validate:"required"`
+	Port     int    `toml:"port" env:"BENCH_DB_PORT" default:"3306" validate:"min=1,max=65535"`
+	User     string `toml:"user" env:"BENCH_DB_USER" default:"app"`
+	Password string `toml:"password" env:"BENCH_DB_PASSWORD" secret:"true"`
+	Name     string `toml:"name" env:"BENCH_DB_NAME" default:"app" validate:"regexp=^[a-z_]+$"`
+}
+
+type BenchConfig struct {
+	Listen  string  `toml:"listen" env:"BENCH_LISTEN" default:"127.0.0.1:8080" validate:"hostport"`
+	Mode    string  `toml:"mode" env:"BENCH_MODE" default:"prod" validate:"oneof=dev|prod"`
+	Workers int     `toml:"workers" env:"BENCH_WORKERS" default:"4" validate:"min=1"`
+	Debug   bool    `toml:"debug" env:"BENCH_DEBUG"`
+	DB      BenchDB `toml:"db"`
+}
+
+func BenchmarkDefaultsEnv(b *testing.B) {
+	b.Setenv("BENCH_LISTEN", "0.0.0.0:9090")
+	b.Setenv("BENCH_WORKERS", "16")
+
+	walkers := map[string]struct {
+		defaults func(v *reflect.Value, path string, p Provenance, errs *LoadErrors)
+		env      func(v *reflect.Value, path string, ep *envPass)
+	}{
+		"plan":    {setDefaults, setEnv},
+		"reflect": {legacySetDefaults, legacySetEnv},
+	}
+
+	for _, name := range []string{"plan", "reflect"} {
+		w := walkers[name]
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				var cfg BenchConfig
+				rv := reflect.ValueOf(&cfg)
+
+				var errs LoadErrors
+				w.defaults(&rv, "", nil, &errs)
+
+				ep := &envPass{seen: map[string]bool{}}
+				w.env(&rv, "", ep)
+
+				if err := errs.err(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSetToml(b *testing.B) {
+	var src BenchConfig
+	if err := FromDefaults(&src); err != nil {
+		b.Fatal(err)
+	}
+
+	sv := reflect.ValueOf(&src).Elem()
+
+	doc, err := MarshalTOML(src)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	md, err := toml.Decode(string(doc), &BenchConfig{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	defined := tomlDefined(md)
+
+	walkers := map[string]func(dst *reflect.Value, src reflect.Value, path, key string, defined map[string]bool, o *tomlOrigins) error{
+		"plan":    setToml,
+		"reflect": legacySetToml,
+	}
+
+	for _, name := range []string{"plan", "reflect"} {
+		walk := walkers[name]
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				var dst BenchConfig
+				dv := reflect.ValueOf(&dst).Elem()
+				if err := walk(&dv, sv, "", "", defined, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
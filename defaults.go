@@ -1,9 +1,6 @@
 package configo
 
-import (
-	"fmt"
-	"reflect"
-)
+import "reflect"
 
 type DefaultsConfigo struct{}
 
@@ -13,6 +10,26 @@ func (dc *DefaultsConfigo) Load(v interface{}) error {
 	return FromDefaults(v)
 }
 
+// loadDeferred sets the defaults of `v` but leaves derived defaults unset
+// until the returned function is called.
+func (dc *DefaultsConfigo) loadDeferred(v interface{}, p Provenance) (func() error, error) {
+	rv, err := target(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs LoadErrors
+	setDefaults(&rv, "", p, &errs)
+
+	derive := func() error {
+		var errs LoadErrors
+		deriveDefaults(rv, "", p, &errs)
+		return errs.err()
+	}
+
+	return derive, errs.err()
+}
+
 // FromDefaults sets pointer `v` based on default values of `v`.
 //
 // A field's value will be determined based on the following order:
@@ -20,15 +37,30 @@ func (dc *DefaultsConfigo) Load(v interface{}) error {
 // 1. If `v` already contains a value for the field, it will be used.
 // 2. If a "default" tag exists for a field, its value will be used, subject to type casting.
 // 3. The field will be initialized to its zero value (i.e., "" for string, 0 for int, etc).
+//
+// A "default" tag may be derived from other fields of the struct holding the
+// field, given as a text/template such as `default:"{{.DataDir}}/cache"` or
+// with "${.Name}" references to Go field paths such as
+// `default:"${.Host}:${.DB.Port:-5432}"`. Derived defaults are evaluated after every
+// other default, in an order where each follows the fields it refers to, and
+// only for fields that are still unset. In a ConfigoChain they are evaluated
+// once all other sources ran, so they see the final values.
+//
+// Every field is visited even if an earlier one fails; the returned error is a
+// *LoadErrors listing all failures.
 func FromDefaults(v interface{}) error {
-	rv := reflect.ValueOf(v).Elem()
+	rv, err := target(v)
+	if err != nil {
+		return err
+	}
 
-	return setDefaults(&rv)
+	var errs LoadErrors
+	setDefaults(&rv, "", nil, &errs)
+	deriveDefaults(rv, "", nil, &errs)
+	return errs.err()
 }
 
-func setDefaults(v *reflect.Value) error {
-	var err error
-
+func setDefaults(v *reflect.Value, path string, p Provenance, errs *LoadErrors) {
 	// TODO: Properly initialize struct pointers
 	// e.g. given "type Foo struct { Bar *OtherStruct }" set Bar's fields
 	// to their zero-value.
@@ -41,64 +73,45 @@ func setDefaults(v *reflect.Value) error {
 
 		nv := v.Elem()
 
-		err = setDefaults(&nv)
-		if err != nil {
-			return err
-		}
-
-		v = &nv
+		setDefaults(&nv, path, p, errs)
 	case reflect.Struct:
-		for i := 0; i < v.NumField(); i++ {
-			val := v.Field(i)
-			typ := v.Type().Field(i)
-
-			kind := val.Kind()
+		plan := planFor(v.Type())
 
-			if kind == reflect.Struct {
-				err = setDefaults(&val)
-				if err != nil {
-					return err
-				}
+		for i := range plan.fields {
+			fp := &plan.fields[i]
+			val := v.Field(fp.index)
+			fpath := joinPath(path, fp.name)
 
+			if fp.nested(val) {
+				setDefaults(&val, fpath, p, errs)
 				continue
 			}
 
-			if kind == reflect.Ptr && val.Elem().Kind() == reflect.Struct {
-				err = setDefaults(&val)
-				if err != nil {
-					return err
-				}
+			if fp.defErr != nil {
+				errs.add(newFieldError(fpath, "default", fp.def, fp.secret, fp.defErr))
+				continue
+			}
 
+			if fp.def != "" && fp.strings == noString {
+				errs.add(newFieldError(fpath, "default", fp.def, fp.secret, unsupported(val.Type())))
 				continue
 			}
 
 			if isZero(val) {
-				switch val.Kind() {
-				case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.String:
-					val.Set(reflect.ValueOf(val.Interface()))
-				case reflect.Ptr:
+				if val.Kind() == reflect.Ptr {
 					val.Set(reflect.New(val.Type().Elem()))
-				default:
-					// TODO: Do something with unknown types
 				}
 
-				tag := typ.Tag.Get("default")
-				if tag != "" {
-					err = set(&val, tag)
+				if fp.def != "" && !fp.derived && fp.strings == fromString {
+					err := fp.conv(val, fp.def)
 					if err != nil {
-						err = fmt.Errorf("default %s: %s", typ.Name, err)
-						return err
+						errs.add(newFieldError(fpath, "default", fp.def, fp.secret, err))
+						continue
 					}
+
+					p.record(fpath, Origin{Source: "default"})
 				}
 			}
 		}
-	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.String:
-		if isZero(*v) {
-			v.Set(reflect.ValueOf(v.Interface()))
-		}
-	default:
-		// TODO: Do something with unknown value types
 	}
-
-	return nil
 }
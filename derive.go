@@ -0,0 +1,288 @@
+package configo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/kimor79/configo/internal/tags"
+)
+
+// A derived default is a "default" tag computed from other fields of the
+// struct holding it, e.g. `default:"${.Host}:${.Port}"` or
+// `default:"{{.DataDir}}/cache"`. Derived defaults are only evaluated once
+// every other source has run, so they see the final values of the fields
+// they reference. A reference to a field without the leading dot, e.g.
+// `default:"${Host}:${Port}"`, is reported rather than kept as text.
+
+// derivedRef matches a "${.Name}" or "${.Name:-fallback}" reference.
+var derivedRef = tags.DerivedRef
+
+// isDerived reports whether the "default" tag `tag` is a derived default: a
+// template, or a tag with a "${.Name}" reference to a Go field path.
+func isDerived(tag string) bool {
+	return tags.IsDerived(tag)
+}
+
+// fieldByPath returns the field of struct type `t` named by the dotted path
+// of Go field names `path`.
+func fieldByPath(t reflect.Type, path string) (reflect.StructField, bool) {
+	fields, ok := tags.FieldByPath(t, path, func(t reflect.Type, name string) (reflect.StructField, reflect.Type, bool) {
+		t = derefType(t)
+		if t.Kind() != reflect.Struct {
+			return reflect.StructField{}, nil, false
+		}
+
+		f, ok := t.FieldByName(name)
+		if !ok || f.PkgPath != "" {
+			return f, nil, false
+		}
+
+		return f, f.Type, true
+	})
+	if !ok {
+		return reflect.StructField{}, false
+	}
+
+	return fields[len(fields)-1], true
+}
+
+var (
+	errDeriveCycle = errors.New("default depends on itself through other derived defaults")
+	errDeriveField = errors.New("default refers to an unknown field")
+	errDeriveBare  = errors.New("default refers to a field without the leading dot")
+)
+
+// bareRefError returns an error if the "default" tag `tag` of a field of
+// struct type `t` refers to a field of `t` as "${Name}" rather than
+// "${.Name}", which would otherwise be kept as it is.
+func bareRefError(t reflect.Type, tag string) error {
+	for _, name := range tags.BareRefs(tag) {
+		if _, ok := fieldByPath(t, name); ok {
+			return fmt.Errorf("%w: use ${.%s}", errDeriveBare, name)
+		}
+	}
+
+	return nil
+}
+
+// derivedField is a field with a derived default that is still unset.
+type derivedField struct {
+	path string
+	tag  string
+	val  reflect.Value
+	typ  reflect.StructField
+	conv converter
+	tmpl *template.Template
+	// deps lists the fields of the same struct the default refers to.
+	deps []string
+}
+
+// deriveDefaults evaluates the derived defaults of the unset fields of `v`.
+// Nested structs are evaluated first, then the fields of a struct in an
+// order where every default is evaluated after the fields it refers to.
+func deriveDefaults(v reflect.Value, path string, p Provenance, errs *LoadErrors) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+
+		deriveDefaults(v.Elem(), path, p, errs)
+	case reflect.Struct:
+		fields := map[string]*derivedField{}
+
+		plan := planFor(v.Type())
+
+		for i := range plan.fields {
+			fp := &plan.fields[i]
+			val := v.Field(fp.index)
+			fpath := joinPath(path, fp.name)
+
+			if fp.nested(val) {
+				deriveDefaults(val, fpath, p, errs)
+				continue
+			}
+
+			if !fp.derived || fp.strings != fromString {
+				continue
+			}
+
+			typ := v.Type().Field(fp.index)
+			tag := fp.def
+
+			if e := indirect(val); e.IsValid() && !e.IsZero() {
+				continue
+			}
+
+			df := &derivedField{path: fpath, tag: tag, val: val, typ: typ, conv: fp.conv}
+
+			err := df.parse(v.Type())
+			if err != nil {
+				errs.add(newFieldError(fpath, "default", tag, isSecret(typ), err))
+				continue
+			}
+
+			fields[typ.Name] = df
+		}
+
+		order, stuck := deriveOrder(fields)
+
+		for _, df := range stuck {
+			errs.add(newFieldError(df.path, "default", df.tag, isSecret(df.typ), errDeriveCycle))
+		}
+
+		for _, df := range order {
+			s, err := df.eval(v)
+			if err == nil {
+				err = df.conv(df.val, s)
+			}
+
+			if err != nil {
+				errs.add(newFieldError(df.path, "default", df.tag, isSecret(df.typ), err))
+				continue
+			}
+
+			p.record(df.path, Origin{Source: "default"})
+		}
+	}
+}
+
+// parse finds the fields the default refers to, parsing it as a template
+// if needed.
+func (df *derivedField) parse(t reflect.Type) error {
+	if !strings.Contains(df.tag, "{{") {
+		for _, m := range derivedRef.FindAllStringSubmatch(df.tag, -1) {
+			if _, ok := fieldByPath(t, m[1]); !ok {
+				return fmt.Errorf("%w %s", errDeriveField, m[1])
+			}
+
+			name, _, _ := strings.Cut(m[1], ".")
+			df.deps = append(df.deps, name)
+		}
+
+		return nil
+	}
+
+	tmpl, err := template.New(df.path).Option("missingkey=error").Parse(df.tag)
+	if err != nil {
+		return err
+	}
+
+	df.tmpl = tmpl
+	templateFields(tmpl.Root, &df.deps)
+
+	return nil
+}
+
+// eval returns the value of the default given the struct `v` holding the
+// field.
+func (df *derivedField) eval(v reflect.Value) (string, error) {
+	if df.tmpl != nil {
+		data := v.Interface()
+		if v.CanAddr() {
+			data = v.Addr().Interface()
+		}
+
+		var b strings.Builder
+
+		err := df.tmpl.Execute(&b, data)
+		if err != nil {
+			return "", err
+		}
+
+		return b.String(), nil
+	}
+
+	return derivedRef.ReplaceAllStringFunc(df.tag, func(ref string) string {
+		m := derivedRef.FindStringSubmatch(ref)
+
+		val, ok := valueByPath(v, m[1])
+		if !ok {
+			return ref
+		}
+
+		s := ""
+		if val.IsValid() {
+			s = interpText(val)
+		}
+
+		if s == "" && strings.Contains(ref, ":-") {
+			return m[2]
+		}
+
+		return s
+	}), nil
+}
+
+// valueByPath returns the value of the field of struct `v` named by the
+// dotted path `path`, invalid if a pointer on the way is nil.
+func valueByPath(v reflect.Value, path string) (reflect.Value, bool) {
+	if _, ok := fieldByPath(v.Type(), path); !ok {
+		return reflect.Value{}, false
+	}
+
+	for _, name := range strings.Split(path, ".") {
+		v = indirect(v)
+		if !v.IsValid() {
+			return v, true
+		}
+
+		v = v.FieldByName(name)
+	}
+
+	return indirect(v), true
+}
+
+// templateFields appends to `deps` the first field name of every field
+// reference in the template node `n`, e.g. "DB" for {{.DB.Host}}.
+func templateFields(n parse.Node, deps *[]string) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+
+		for _, c := range n.Nodes {
+			templateFields(c, deps)
+		}
+	case *parse.ActionNode:
+		templateFields(n.Pipe, deps)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+
+		for _, c := range n.Cmds {
+			templateFields(c, deps)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			templateFields(a, deps)
+		}
+	case *parse.FieldNode:
+		*deps = append(*deps, n.Ident[0])
+	case *parse.ChainNode:
+		templateFields(n.Node, deps)
+	case *parse.IfNode:
+		templateFields(&n.BranchNode, deps)
+	case *parse.RangeNode:
+		templateFields(&n.BranchNode, deps)
+	case *parse.WithNode:
+		templateFields(&n.BranchNode, deps)
+	case *parse.BranchNode:
+		templateFields(n.Pipe, deps)
+		templateFields(n.List, deps)
+		templateFields(n.ElseList, deps)
+	}
+}
+
+// deriveOrder sorts `fields` so every field follows the fields it depends
+// on. Fields depending on each other in a cycle, directly or not, are
+// returned as `stuck`.
+func deriveOrder(fields map[string]*derivedField) (order, stuck []*derivedField) {
+	return tags.DeriveOrder(fields, func(df *derivedField) []string { return df.deps })
+}
@@ -0,0 +1,172 @@
+package configo
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Change describes a leaf value that differs between two configs.
+type Change struct {
+	// Path is the dotted path of the value, with "[i]" or "[key]" appended
+	// for slice and map elements, e.g. "Mysql.Hosts[2]".
+	Path string
+	// Old is the value in the first config, nil if it was absent.
+	Old interface{}
+	// New is the value in the second config, nil if it was removed.
+	New interface{}
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Path, c.Old, c.New)
+}
+
+// Diff compares `a` and `b`, two configs of the same type or pointers to
+// them, and returns every leaf value that differs. Pointers are compared by
+// the values they point to, slices element by element and maps key by key.
+// The values of fields tagged `secret:"true"` are masked.
+func Diff(a, b interface{}) []Change {
+	var changes []Change
+	diff(reflect.ValueOf(a), reflect.ValueOf(b), "", false, &changes)
+	return changes
+}
+
+func diff(a, b reflect.Value, path string, secret bool, changes *[]Change) {
+	a, b = indirect(a), indirect(b)
+
+	if !a.IsValid() && !b.IsValid() {
+		return
+	}
+
+	// Compare a missing struct against an empty one so every field it
+	// gained or lost is listed.
+	if !a.IsValid() && b.Kind() == reflect.Struct {
+		a = reflect.Zero(b.Type())
+	}
+
+	if !b.IsValid() && a.Kind() == reflect.Struct {
+		b = reflect.Zero(a.Type())
+	}
+
+	if !a.IsValid() || !b.IsValid() || a.Type() != b.Type() {
+		addChange(changes, path, a, b, secret)
+		return
+	}
+
+	switch a.Kind() {
+	case reflect.Struct:
+		if !hasExportedFields(a.Type()) {
+			break
+		}
+
+		for i := 0; i < a.NumField(); i++ {
+			typ := a.Type().Field(i)
+			if typ.PkgPath != "" {
+				continue
+			}
+
+			diff(a.Field(i), b.Field(i), joinPath(path, typ.Name), secret || isSecret(typ), changes)
+		}
+
+		return
+	case reflect.Slice, reflect.Array:
+		n := a.Len()
+		if b.Len() > n {
+			n = b.Len()
+		}
+
+		for i := 0; i < n; i++ {
+			var ai, bi reflect.Value
+			if i < a.Len() {
+				ai = a.Index(i)
+			}
+
+			if i < b.Len() {
+				bi = b.Index(i)
+			}
+
+			diff(ai, bi, fmt.Sprintf("%s[%d]", path, i), secret, changes)
+		}
+
+		return
+	case reflect.Map:
+		// Keys are matched as values, so distinct keys that print the same,
+		// such as 1 and "1" in a map[interface{}]T, are compared apart.
+		seen := map[interface{}]bool{}
+		var keys []reflect.Value
+		for _, k := range append(a.MapKeys(), b.MapKeys()...) {
+			if !seen[k.Interface()] {
+				seen[k.Interface()] = true
+				keys = append(keys, k)
+			}
+		}
+
+		sort.Slice(keys, func(i, j int) bool {
+			ki, kj := fmt.Sprint(keys[i].Interface()), fmt.Sprint(keys[j].Interface())
+			if ki != kj {
+				return ki < kj
+			}
+
+			return fmt.Sprintf("%#v", keys[i].Interface()) < fmt.Sprintf("%#v", keys[j].Interface())
+		})
+
+		for _, k := range keys {
+			diff(a.MapIndex(k), b.MapIndex(k), fmt.Sprintf("%s[%v]", path, k.Interface()), secret, changes)
+		}
+
+		return
+	}
+
+	if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+		addChange(changes, path, a, b, secret)
+	}
+}
+
+func addChange(changes *[]Change, path string, a, b reflect.Value, secret bool) {
+	c := Change{Path: path}
+
+	if a.IsValid() && a.CanInterface() {
+		c.Old = a.Interface()
+	}
+
+	if b.IsValid() && b.CanInterface() {
+		c.New = b.Interface()
+	}
+
+	if secret {
+		if c.Old != nil {
+			c.Old = secretMask
+		}
+
+		if c.New != nil {
+			c.New = secretMask
+		}
+	}
+
+	*changes = append(*changes, c)
+}
+
+// indirect follows pointers and interfaces, returning the zero Value for nil.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+
+		v = v.Elem()
+	}
+
+	return v
+}
+
+// hasExportedFields reports whether struct type `t` has fields that can be
+// walked, as opposed to opaque values such as time.Time.
+func hasExportedFields(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			return true
+		}
+	}
+
+	return false
+}
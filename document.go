@@ -0,0 +1,111 @@
+package configo
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"reflect"
+	"strings"
+)
+
+// DocFormat selects the output format of Document.
+type DocFormat int
+
+const (
+	DocMarkdown DocFormat = iota
+	DocHTML
+)
+
+var docColumns = []string{"Path", "TOML key", "Env", "Type", "Default", "Required", "Description"}
+
+// Document returns a reference table of every setting of `v`, a struct or a
+// pointer to one, listing its field path, TOML key, environment variable,
+// type, default, whether it is required and its `desc` tag. Fields of nested
+// structs are listed under their full path.
+//
+// The table is built from the same tags the loaders read, so writing it out
+// from a small program run by `go generate` keeps documentation in sync with
+// the code.
+func Document(v interface{}, format DocFormat) ([]byte, error) {
+	t := derefType(reflect.TypeOf(v))
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("configo: cannot document %T, want a struct", v)
+	}
+
+	var rows [][]string
+	docRows(describe(t), &rows)
+
+	var buf bytes.Buffer
+
+	switch format {
+	case DocMarkdown:
+		docMarkdown(&buf, rows)
+	case DocHTML:
+		docHTML(&buf, rows)
+	default:
+		return nil, fmt.Errorf("configo: unknown document format %d", format)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func docRows(fields []fieldInfo, rows *[][]string) {
+	for _, fi := range fields {
+		if fi.IsTable() || fi.IsTableArray() {
+			docRows(fi.Fields, rows)
+			continue
+		}
+
+		required := ""
+		if fi.Required() {
+			required = "yes"
+		}
+
+		*rows = append(*rows, []string{fi.Path, fi.KeyPath, fi.Env, fi.Type.String(), fi.Default, required, fi.Desc})
+	}
+}
+
+func docMarkdown(buf *bytes.Buffer, rows [][]string) {
+	buf.WriteString("| " + strings.Join(docColumns, " | ") + " |\n")
+	buf.WriteString("|" + strings.Repeat(" --- |", len(docColumns)) + "\n")
+
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cell = strings.ReplaceAll(cell, "|", `\|`)
+			cell = strings.ReplaceAll(cell, "\n", "<br>")
+
+			// Identifiers and values are shown as code.
+			if cell != "" && i <= 4 {
+				cell = "`" + cell + "`"
+			}
+
+			cells[i] = cell
+		}
+
+		buf.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+}
+
+func docHTML(buf *bytes.Buffer, rows [][]string) {
+	buf.WriteString("<table>\n<thead>\n<tr>")
+	for _, col := range docColumns {
+		buf.WriteString("<th>" + html.EscapeString(col) + "</th>")
+	}
+	buf.WriteString("</tr>\n</thead>\n<tbody>\n")
+
+	for _, row := range rows {
+		buf.WriteString("<tr>")
+		for i, cell := range row {
+			cell = html.EscapeString(cell)
+			if cell != "" && i <= 4 {
+				cell = "<code>" + cell + "</code>"
+			}
+
+			buf.WriteString("<td>" + strings.ReplaceAll(cell, "\n", "<br>") + "</td>")
+		}
+		buf.WriteString("</tr>\n")
+	}
+
+	buf.WriteString("</tbody>\n</table>\n")
+}
@@ -0,0 +1,615 @@
+package configo
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Encrypted values are written in config files as strings of the form
+//
+//	"ENC[AES256_GCM,data:...,iv:...,tag:...,type:str]"
+//
+// in the style of sops, with the base64 ciphertext, nonce and
+// authentication tag of the value encrypted by AES-256 in GCM mode, and the
+// TOML type of the value: str, int, float or bool. Only AES-256-GCM with a
+// symmetric key is supported; age and the key management of sops are not.
+//
+// Every value is bound to its dotted TOML key, lowercased, as additional
+// authenticated data, so an encrypted value copied to another key fails to
+// decrypt. Encrypted values must be single-line strings set outside arrays
+// and inline tables.
+
+const (
+	// KeyEnv is the environment variable holding the base64 key that
+	// encrypted values are decrypted with by default.
+	KeyEnv = "CONFIGO_KEY"
+	// KeyFileEnv is the environment variable naming a file holding the
+	// base64 key, used when KeyEnv is not set.
+	KeyFileEnv = "CONFIGO_KEY_FILE"
+)
+
+// KeySource returns a 32 byte AES-256 key.
+type KeySource func() ([]byte, error)
+
+// KeyFromFile reads a base64 key from the file `path`.
+func KeyFromFile(path string) KeySource {
+	return func() ([]byte, error) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return decodeKey(string(b))
+	}
+}
+
+// KeyFromEnv reads a base64 key from the environment variable `name`.
+func KeyFromEnv(name string) KeySource {
+	return func() ([]byte, error) {
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("no key: %s not set", name)
+		}
+
+		return decodeKey(s)
+	}
+}
+
+// DefaultKey reads the key from the variable KeyEnv, or else from the file
+// named by KeyFileEnv.
+func DefaultKey() ([]byte, error) {
+	if _, ok := os.LookupEnv(KeyEnv); ok {
+		return KeyFromEnv(KeyEnv)()
+	}
+
+	if f := os.Getenv(KeyFileEnv); f != "" {
+		return KeyFromFile(f)()
+	}
+
+	return nil, fmt.Errorf("no key: neither %s nor %s set", KeyEnv, KeyFileEnv)
+}
+
+// GenerateKey returns a new random key, base64 encoded.
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %s", err)
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid key: %d bytes, want 32", len(key))
+	}
+
+	return key, nil
+}
+
+// Encrypt encrypts `value`, a string, integer, float or bool, with `key`
+// for the dotted TOML key `path`, e.g. "db.password", and returns it in the
+// "ENC[AES256_GCM,...]" form.
+func Encrypt(key []byte, path string, value interface{}) (string, error) {
+	var typ, plain string
+
+	switch v := value.(type) {
+	case string:
+		typ, plain = "str", v
+	case int64:
+		typ, plain = "int", strconv.FormatInt(v, 10)
+	case int:
+		typ, plain = "int", strconv.Itoa(v)
+	case float64:
+		typ, plain = "float", strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		typ, plain = "bool", strconv.FormatBool(v)
+	default:
+		return "", fmt.Errorf("cannot encrypt %T, only strings, numbers and booleans", value)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, gcm.NonceSize())
+
+	_, err = rand.Read(iv)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nil, iv, []byte(plain), []byte(normalizeTomlKey(path)))
+	data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	enc := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]", enc(data), enc(iv), enc(tag), typ), nil
+}
+
+// Decrypt decrypts the value `s` of the dotted TOML key `path` in the
+// "ENC[AES256_GCM,...]" form with `key`. The value is returned as a string,
+// int64, float64 or bool, as given by its type.
+func Decrypt(key []byte, path, s string) (interface{}, error) {
+	typ, plain, err := decrypt(key, path, s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ {
+	case "int":
+		return strconv.ParseInt(plain, 10, 64)
+	case "float":
+		return strconv.ParseFloat(plain, 64)
+	case "bool":
+		return strconv.ParseBool(plain)
+	}
+
+	return plain, nil
+}
+
+func decrypt(key []byte, path, s string) (typ, plain string, err error) {
+	if !isEncrypted(s) || !strings.HasSuffix(s, "]") {
+		return "", "", fmt.Errorf("not an encrypted value")
+	}
+
+	parts := map[string][]byte{}
+	typ = "str"
+
+	for _, kv := range strings.Split(s[len("ENC[AES256_GCM,"):len(s)-1], ",") {
+		k, v, _ := strings.Cut(kv, ":")
+		if k == "type" {
+			typ = v
+			continue
+		}
+
+		parts[k], err = base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid encrypted value: %s: %s", k, err)
+		}
+	}
+
+	switch typ {
+	case "str", "int", "float", "bool":
+	default:
+		return "", "", fmt.Errorf("invalid encrypted value: unknown type %s", typ)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(parts["iv"]) != gcm.NonceSize() || len(parts["tag"]) != gcm.Overhead() {
+		return "", "", fmt.Errorf("invalid encrypted value: bad iv or tag")
+	}
+
+	b, err := gcm.Open(nil, parts["iv"], append(parts["data"], parts["tag"]...), []byte(normalizeTomlKey(path)))
+	if err != nil {
+		return "", "", fmt.Errorf("cannot decrypt value: wrong key, corrupted data or value moved from another key")
+	}
+
+	return typ, string(b), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func isEncrypted(s string) bool {
+	return strings.HasPrefix(s, "ENC[AES256_GCM,")
+}
+
+// tomlScalar is a string, number or boolean value of a TOML document.
+type tomlScalar struct {
+	// key is the lowercased dotted key of the value.
+	key   string
+	value interface{}
+	line  int
+	// start and end delimit the value in the document, quotes included.
+	// They are 0 when the value cannot be replaced in place: in an array,
+	// in an inline table or a multi-line string.
+	start, end int
+	// multiline is set for multi-line strings, which encrypted values
+	// never are.
+	multiline bool
+}
+
+// tomlScalars returns the scalar values of the TOML document `b` in the
+// order they appear in. Since the document is decoded, comments are never
+// mistaken for values.
+func tomlScalars(b []byte) ([]tomlScalar, error) {
+	var doc map[string]toml.Primitive
+	md, err := toml.Decode(string(b), &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var scalars []tomlScalar
+
+	for k, prim := range doc {
+		tomlPrimitiveScalars(b, md, prim, strings.ToLower(k), &scalars)
+	}
+
+	sort.Slice(scalars, func(i, j int) bool {
+		if scalars[i].line != scalars[j].line {
+			return scalars[i].line < scalars[j].line
+		}
+
+		return scalars[i].start < scalars[j].start
+	})
+
+	return scalars, nil
+}
+
+// tomlPrimitiveScalars appends to `scalars` the value of `key`, `prim`, or
+// the scalars of the tables it holds.
+func tomlPrimitiveScalars(b []byte, md toml.MetaData, prim toml.Primitive, key string, scalars *[]tomlScalar) {
+	var value interface{}
+	if md.PrimitiveDecode(prim, &value) != nil {
+		return
+	}
+
+	var tables []map[string]toml.Primitive
+
+	switch value.(type) {
+	case map[string]interface{}:
+		var table map[string]toml.Primitive
+		if md.PrimitiveDecode(prim, &table) != nil {
+			return
+		}
+
+		tables = append(tables, table)
+	case []map[string]interface{}:
+		if md.PrimitiveDecode(prim, &tables) != nil {
+			return
+		}
+	}
+
+	if tables != nil {
+		for _, table := range tables {
+			for k, p := range table {
+				tomlPrimitiveScalars(b, md, p, joinPath(key, strings.ToLower(k)), scalars)
+			}
+		}
+
+		return
+	}
+
+	sc := tomlScalar{key: key, value: value}
+
+	var pe toml.ParseError
+	if errors.As(md.PrimitiveDecode(prim, &tomlLineProbe{}), &pe) && pe.Position.Start+pe.Position.Len <= len(b) {
+		sc.line = bytes.Count(b[:pe.Position.Start], []byte("\n")) + 1
+
+		start := pe.Position.Start
+		if _, ok := value.(string); ok && start >= 3 {
+			q := string(b[start-3 : start])
+			sc.multiline = q == `"""` || q == "'''"
+		}
+
+		switch value.(type) {
+		case string, int64, float64, bool:
+			sc.start, sc.end = tomlValueSpan(b, start, start+pe.Position.Len, value)
+		}
+	}
+
+	*scalars = append(*scalars, sc)
+}
+
+// tomlValueSpan returns where the scalar `value`, reported by the decoder
+// between `start` and `end`, is in the document `b`, quotes included, or 0,
+// 0 if it is not there. The decoder reports the key of values of inline
+// tables instead, and multi-line strings cannot be replaced by a single
+// line value.
+func tomlValueSpan(b []byte, start, end int, value interface{}) (int, int) {
+	if _, ok := value.(string); ok {
+		if start == 0 || end >= len(b) || (b[start-1] != '"' && b[start-1] != '\'') || b[end] != b[start-1] {
+			return 0, 0
+		}
+
+		if start >= 3 && b[start-2] == b[start-1] && b[start-3] == b[start-1] {
+			return 0, 0
+		}
+
+		start, end = start-1, end+1
+	}
+
+	rest := bytes.TrimLeft(b[end:], " \t")
+	if len(rest) > 0 && (rest[0] == '=' || rest[0] == '.') {
+		return 0, 0
+	}
+
+	return start, end
+}
+
+// tomlDecrypt replaces the encrypted values in the TOML document `b`, from
+// the file `f`, by their plaintext as TOML literals of their type. Values
+// that fail to decrypt are reported as a *FieldError naming the field of
+// `t` their key maps onto.
+func tomlDecrypt(f string, b []byte, t reflect.Type, key KeySource) ([]byte, error) {
+	if !bytes.Contains(b, []byte("ENC[AES256_GCM,")) {
+		return b, nil
+	}
+
+	scalars, err := tomlScalars(b)
+	if err != nil {
+		// The decoder reports the error with the field it belongs to.
+		return b, nil
+	}
+
+	var k []byte
+	var errs LoadErrors
+
+	out := replaceScalars(b, scalars, func(sc tomlScalar) ([]byte, error) {
+		s, ok := sc.value.(string)
+		if !ok || !isEncrypted(s) || sc.multiline {
+			return nil, nil
+		}
+
+		if sc.end == 0 {
+			return nil, errEncryptedPlace
+		}
+
+		if k == nil {
+			var err error
+			if k, err = key(); err != nil {
+				return nil, err
+			}
+		}
+
+		typ, plain, err := decrypt(k, sc.key, s)
+		if err != nil {
+			return nil, err
+		}
+
+		switch typ {
+		case "str":
+			return []byte(tomlString(plain)), nil
+		case "int":
+			_, err = strconv.ParseInt(plain, 10, 64)
+		case "float":
+			_, err = strconv.ParseFloat(plain, 64)
+		case "bool":
+			_, err = strconv.ParseBool(plain)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(plain), nil
+	}, func(sc tomlScalar, err error) {
+		path, secret := tomlKeyField(t, sc.key)
+		errs.add(newFieldError(path, "toml:"+tomlPos(f, sc.line), sc.value.(string), secret, err))
+	})
+
+	return out, errs.err()
+}
+
+// hasEncrypted reports whether the TOML document `b` holds encrypted
+// values.
+func hasEncrypted(b []byte) bool {
+	if !bytes.Contains(b, []byte("ENC[AES256_GCM,")) {
+		return false
+	}
+
+	scalars, err := tomlScalars(b)
+	if err != nil {
+		return false
+	}
+
+	for _, sc := range scalars {
+		if s, ok := sc.value.(string); ok && isEncrypted(s) && !sc.multiline {
+			return true
+		}
+	}
+
+	return false
+}
+
+var errEncryptedPlace = errors.New("encrypted values must be strings set outside arrays and inline tables")
+
+// EncryptFile encrypts the values of the dotted TOML keys `keys`, e.g.
+// "db.password", in the file `path`. Values must be single-line strings,
+// numbers or booleans outside arrays and inline tables; values already
+// encrypted are left as they are. Comments and formatting are kept, and the
+// file is replaced at once so it is never left partly written.
+func EncryptFile(path string, key []byte, keys ...string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	scalars, err := tomlScalars(b)
+	if err != nil {
+		return err
+	}
+
+	want := map[string]string{}
+
+	for _, k := range keys {
+		nk := normalizeTomlKey(k)
+		want[nk] = k
+
+		found := false
+		for _, sc := range scalars {
+			found = found || sc.key == nk
+		}
+
+		if !found {
+			return fmt.Errorf("%s: %s: %w", path, k, ErrUnknownKey)
+		}
+	}
+
+	var rerr error
+
+	out := replaceScalars(b, scalars, func(sc tomlScalar) ([]byte, error) {
+		if _, ok := want[sc.key]; !ok {
+			return nil, nil
+		}
+
+		if s, ok := sc.value.(string); ok && isEncrypted(s) {
+			return nil, nil
+		}
+
+		if sc.end == 0 {
+			return nil, fmt.Errorf("only single-line values outside arrays and inline tables can be encrypted")
+		}
+
+		enc, err := Encrypt(key, sc.key, sc.value)
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(tomlString(enc)), nil
+	}, func(sc tomlScalar, err error) {
+		if rerr == nil {
+			rerr = fmt.Errorf("%s: %s: %s", tomlPos(path, sc.line), want[sc.key], err)
+		}
+	})
+
+	if rerr != nil {
+		return rerr
+	}
+
+	return writeFileAtomic(path, out)
+}
+
+// RotateFile re-encrypts every encrypted value in the file `path`, from
+// `oldKey` to `newKey`. The file is replaced at once.
+func RotateFile(path string, oldKey, newKey []byte) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	scalars, err := tomlScalars(b)
+	if err != nil {
+		return err
+	}
+
+	var rerr error
+
+	out := replaceScalars(b, scalars, func(sc tomlScalar) ([]byte, error) {
+		s, ok := sc.value.(string)
+		if !ok || !isEncrypted(s) || sc.multiline {
+			return nil, nil
+		}
+
+		if sc.end == 0 {
+			return nil, errEncryptedPlace
+		}
+
+		value, err := Decrypt(oldKey, sc.key, s)
+		if err == nil {
+			s, err = Encrypt(newKey, sc.key, value)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(tomlString(s)), nil
+	}, func(sc tomlScalar, err error) {
+		if rerr == nil {
+			rerr = fmt.Errorf("%s: %s", tomlPos(path, sc.line), err)
+		}
+	})
+
+	if rerr != nil {
+		return rerr
+	}
+
+	return writeFileAtomic(path, out)
+}
+
+// replaceScalars replaces the scalars of the TOML document `b` by the
+// result of `fn`, keeping those it returns nil for. Errors of `fn` are
+// passed to `fail`.
+func replaceScalars(b []byte, scalars []tomlScalar, fn func(tomlScalar) ([]byte, error), fail func(tomlScalar, error)) []byte {
+	var out []byte
+	last := 0
+
+	for _, sc := range scalars {
+		r, err := fn(sc)
+		if err != nil {
+			fail(sc, err)
+			continue
+		}
+
+		if r == nil || sc.end == 0 {
+			continue
+		}
+
+		out = append(out, b[last:sc.start]...)
+		out = append(out, r...)
+		last = sc.end
+	}
+
+	return append(out, b[last:]...)
+}
+
+// writeFileAtomic replaces the existing file `path` by `b` as replaceFile
+// does, keeping its mode.
+func writeFileAtomic(path string, b []byte) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	return replaceFile(path, b, fi.Mode().Perm())
+}
+
+// replaceFile writes `b` to a temporary file of mode `perm` in the directory
+// of `path`, then renames it to `path`, so the file is never left partly
+// written.
+func replaceFile(path string, b []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -1,17 +1,56 @@
 package configo
 
 import (
-	"fmt"
+	"errors"
 	"os"
 	"reflect"
+	"sort"
+	"strings"
 )
 
-type EnvConfigo struct{}
+type EnvConfigo struct {
+	prefix string
+	strict bool
+	logger Logger
+}
 
 func NewEnvConfigo() *EnvConfigo { return &EnvConfigo{} }
 
+// Prefix makes Load look up the variable named by an "env" tag with `prefix`
+// prepended, e.g. `env:"PORT"` reads APP_PORT given the prefix "APP_".
+func (c *EnvConfigo) Prefix(prefix string) *EnvConfigo {
+	c.prefix = prefix
+	return c
+}
+
+// Strict makes Load fail on environment variables starting with the prefix
+// that match no field. Each such variable is reported as an
+// *UnknownKeyError. Since only prefixed variables can be told apart from
+// the rest of the environment, Load fails if no prefix is set.
+func (c *EnvConfigo) Strict() *EnvConfigo {
+	c.strict = true
+	return c
+}
+
+// Logger sets where warnings about aliases and deprecated variables are
+// logged. Without a Logger, they are dropped.
+func (c *EnvConfigo) Logger(l Logger) *EnvConfigo {
+	c.logger = l
+	return c
+}
+
+func (c *EnvConfigo) useLogger(l Logger) {
+	if c.logger == nil {
+		c.logger = l
+	}
+}
+
 func (c *EnvConfigo) Load(v interface{}) error {
-	return FromEnv(v)
+	return c.load(v, nil)
+}
+
+func (c *EnvConfigo) track(v interface{}, p Provenance) error {
+	return c.load(v, p)
 }
 
 // FromEnv sets pointer `v` based on the environment.
@@ -20,71 +59,139 @@ func (c *EnvConfigo) Load(v interface{}) error {
 //
 // 1. If an "env" tag exists for a field and an environment variable matching the tag's value exists, the environment variable's value will be used, subject to type casting.
 // 2. If `v` already contains a value for the field, it will be used.
+//
+// Every field is visited even if an earlier one fails; the returned error is a
+// *LoadErrors listing all failures.
 func FromEnv(v interface{}) error {
-	rv := reflect.ValueOf(v).Elem()
+	return NewEnvConfigo().Load(v)
+}
 
-	return setEnv(&rv)
+// envPass holds the state of a single walk of setEnv over a struct.
+type envPass struct {
+	prefix string
+	prov   Provenance
+	logger Logger
+	errs   LoadErrors
+	// seen holds every variable named by a field.
+	seen map[string]bool
 }
 
-func setEnv(v *reflect.Value) error {
-	var err error
+func (c *EnvConfigo) load(v interface{}, p Provenance) error {
+	rv, err := target(v)
+	if err != nil {
+		return err
+	}
+
+	if c.strict && c.prefix == "" {
+		return errors.New("configo: strict environment variables need a prefix")
+	}
+
+	ep := &envPass{prefix: c.prefix, prov: p, logger: c.logger, seen: map[string]bool{}}
+	setEnv(&rv, "", ep)
+
+	if c.strict {
+		var unknown []string
+		for _, kv := range os.Environ() {
+			name := kv[:strings.Index(kv, "=")]
+			if strings.HasPrefix(name, c.prefix) && !ep.seen[name] {
+				unknown = append(unknown, name)
+			}
+		}
+
+		sort.Strings(unknown)
+
+		for _, name := range unknown {
+			ep.errs.add(&UnknownKeyError{Key: name, Source: "env:" + name})
+		}
+	}
 
+	return ep.errs.err()
+}
+
+func setEnv(v *reflect.Value, path string, ep *envPass) {
 	switch v.Kind() {
 	case reflect.Ptr:
 		nv := v.Elem()
 
-		err = setEnv(&nv)
-		if err != nil {
-			return err
-		}
-
-		v = &nv
+		setEnv(&nv, path, ep)
 	case reflect.Struct:
-		for i := 0; i < v.NumField(); i++ {
-			val := v.Field(i)
-			typ := v.Type().Field(i)
+		plan := planFor(v.Type())
 
-			kind := val.Kind()
+		for i := range plan.fields {
+			fp := &plan.fields[i]
+			val := v.Field(fp.index)
+			fpath := joinPath(path, fp.name)
 
-			if kind == reflect.Struct {
-				err = setEnv(&val)
-				if err != nil {
-					return err
-				}
+			if fp.aliasErr != nil {
+				ep.errs.add(newFieldError(fpath, "alias", fp.alias, false, fp.aliasErr))
+			}
 
+			if fp.nested(val) {
+				setEnv(&val, fpath, ep)
 				continue
 			}
 
-			if kind == reflect.Ptr && val.Elem().Kind() == reflect.Struct {
-				err = setEnv(&val)
-				if err != nil {
-					return err
-				}
-
+			if fp.env == "" && fp.envAliases == nil {
 				continue
 			}
 
-			tag := typ.Tag.Get("env")
-			if tag == "" {
+			name, getenv := ep.lookup(fp)
+
+			if fp.strings == noString {
+				if name == "" {
+					name = ep.prefix + fp.envAliases[0]
+				}
+
+				ep.errs.add(newFieldError(fpath, "env:"+name, getenv, fp.secret, unsupported(val.Type())))
 				continue
 			}
 
-			getenv := os.Getenv(tag)
-			if getenv == "" {
+			if getenv == "" || fp.strings == ignoreString {
 				continue
 			}
 
-			err = set(&val, getenv)
+			err := fp.conv(val, getenv)
 			if err != nil {
-				err = fmt.Errorf("default %s: %s", typ.Name, err)
-				return err
+				ep.errs.add(newFieldError(fpath, "env:"+name, getenv, fp.secret, err))
+				continue
 			}
+
+			ep.prov.record(fpath, Origin{Source: "env", Var: name})
+		}
+	}
+}
+
+// lookup returns the variable setting field `fp` and its value: the one
+// named by its "env" tag, or else the first of the variables in its "alias"
+// tag that is set. Aliases and deprecated variables found are warned about.
+func (ep *envPass) lookup(fp *fieldPlan) (name, value string) {
+	if fp.env != "" {
+		name = ep.prefix + fp.env
+		ep.seen[name] = true
+		value = os.Getenv(name)
+
+		if value != "" && fp.deprecated != "" {
+			warnDeprecated(ep.logger, "environment variable "+name, "", fp.deprecated)
+		}
+	}
+
+	for _, alias := range fp.envAliases {
+		aname := ep.prefix + alias
+		ep.seen[aname] = true
+
+		avalue := os.Getenv(aname)
+		if avalue == "" {
+			continue
 		}
-	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.String:
-		v.Set(reflect.ValueOf(v.Interface()))
-	default:
-		// TODO: Do something with unknown value types
+
+		if value != "" {
+			logf(ep.logger, "configo: environment variable %s is ignored since %s is set", aname, name)
+			continue
+		}
+
+		warnDeprecated(ep.logger, "environment variable "+aname, name, fp.deprecated)
+		name, value = aname, avalue
 	}
 
-	return nil
+	return name, value
 }
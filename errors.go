@@ -0,0 +1,136 @@
+package configo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kimor79/configo/internal/tags"
+)
+
+// ErrUnknownKey is wrapped by the *UnknownKeyError of a setting that matches
+// no field, reported by sources in strict mode.
+var ErrUnknownKey = errors.New("unknown key")
+
+// ErrUnsupportedType is wrapped by the *FieldError of a field with an "env"
+// or "default" tag whose type a string cannot be converted to, such as a
+// channel, func, complex number or interface. It is reported on every load,
+// whether or not the variable is set. Slices and maps are only read from
+// files; their "env" and "default" tags are ignored.
+var ErrUnsupportedType = errors.New("unsupported type")
+
+// ErrInvalidTarget is returned when the value to load a config into is not a
+// struct, or a pointer to one as required.
+var ErrInvalidTarget = errors.New("invalid target")
+
+// ErrInvalidAlias is wrapped by the *FieldError of a field whose "alias"
+// tag lists an invalid name, or an upper case name without an "env:" or
+// "toml:" prefix. The field's source is "alias"; the error is reported on
+// every load by the sources reading aliases, and the name is ignored.
+var ErrInvalidAlias = tags.ErrAlias
+
+// ErrEncryptedMigration is returned by Migrations.MigrateFile for a file
+// holding encrypted values, which are bound to their key and would no longer
+// decrypt once moved to another.
+var ErrEncryptedMigration = errors.New("files with encrypted values cannot be migrated in place")
+
+// LoadErrors collects every error encountered while loading a config so that
+// all broken settings can be reported at once. It supports errors.Is and
+// errors.As through Unwrap.
+type LoadErrors struct {
+	Errs []error
+}
+
+func (e *LoadErrors) Error() string {
+	if len(e.Errs) == 1 {
+		return e.Errs[0].Error()
+	}
+
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%d errors: %s", len(e.Errs), strings.Join(msgs, "; "))
+}
+
+func (e *LoadErrors) Unwrap() []error {
+	return e.Errs
+}
+
+// add appends `err` to the collected errors, flattening nested LoadErrors.
+// An invalid "alias" tag, reported by every source reading aliases, is only
+// collected once.
+func (e *LoadErrors) add(err error) {
+	if err == nil {
+		return
+	}
+
+	if le, ok := err.(*LoadErrors); ok {
+		for _, err := range le.Errs {
+			e.add(err)
+		}
+
+		return
+	}
+
+	if fe, ok := err.(*FieldError); ok && fe.Source == "alias" {
+		for _, c := range e.Errs {
+			if c, ok := c.(*FieldError); ok && *c == *fe {
+				return
+			}
+		}
+	}
+
+	e.Errs = append(e.Errs, err)
+}
+
+// err returns `e` as an error, or nil if nothing was collected.
+func (e *LoadErrors) err() error {
+	if len(e.Errs) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// FieldError describes a failure to set a single field.
+type FieldError struct {
+	// Path is the dotted path of the field, e.g. "Mysql.Pool.Max".
+	Path string
+	// Source names where the value came from, e.g. "default", "env:APP_MAX"
+	// or "toml:config.toml:12", or the hook that failed, "AfterLoad" or
+	// "Validate".
+	Source string
+	// Value is the raw value that could not be used.
+	Value string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %s=%q: %s", e.Source, e.Path, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownKeyError describes a setting that matches no field, reported by
+// sources in strict mode. It wraps ErrUnknownKey.
+type UnknownKeyError struct {
+	// Key is the dotted TOML key or the environment variable, e.g.
+	// "mysql.dsn" or "APP_PORT".
+	Key string
+	// Source names where the setting came from, e.g. "env:APP_PORT" or
+	// "toml:config.toml:12".
+	Source string
+}
+
+func (e *UnknownKeyError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Source, e.Key, ErrUnknownKey)
+}
+
+func (e *UnknownKeyError) Unwrap() error {
+	return ErrUnknownKey
+}
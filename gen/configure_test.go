@@ -0,0 +1,106 @@
+package gen
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/kimor79/configo"
+	"github.com/kimor79/configo/gen/testdata/app"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConfigure checks that the loaders generated in testdata/app load the
+// same config, and fail with the same errors, as a configo chain.
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+	}{
+		{
+			name: "defaults",
+			env: map[string]string{
+				"APP_PEERS": "d,e",
+			},
+		},
+		{
+			name: "valid",
+			file: "valid.toml",
+			env: map[string]string{
+				"APP_THREADS": "8",
+				"APP_DB_PORT": "6432",
+				"APP_DB_USER": "admin",
+				"APP_MODE":    "prod",
+				"APP_LABELS":  "team=ops",
+			},
+		},
+		{
+			name: "invalid",
+			file: "invalid.toml",
+			env: map[string]string{
+				"APP_WORKERS": "100",
+				"APP_DB_PORT": "70000",
+				"APP_DEBUG":   "maybe",
+			},
+		},
+		{
+			name: "hooks",
+			file: "valid.toml",
+			env: map[string]string{
+				"APP_LISTEN": "0.0.0.0:80",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			var sources []configo.Configo
+			sources = append(sources, configo.NewDefaultsConfigo())
+
+			var decode func(c *app.Config) error
+			if tt.file != "" {
+				f := filepath.Join("testdata", "configure", tt.file)
+				sources = append(sources, configo.NewTomlConfigo(f))
+
+				decode = func(c *app.Config) error {
+					_, err := toml.DecodeFile(f, c)
+					return err
+				}
+			}
+
+			sources = append(sources, configo.NewEnvConfigo().Prefix("APP_"), configo.NewValidateConfigo())
+
+			var want app.Config
+			werr := configo.NewConfigoChain(sources...).Load(&want)
+
+			var got app.Config
+			gerr := got.Configure(decode, "APP_")
+
+			assert.Equal(t, want, got)
+			assert.ElementsMatch(t, errorMessages(werr), errorMessages(gerr))
+		})
+	}
+}
+
+// errorMessages returns the messages of the errors joined in `err`.
+func errorMessages(err error) []string {
+	if err == nil {
+		return nil
+	}
+
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var msgs []string
+		for _, e := range joined.Unwrap() {
+			msgs = append(msgs, errorMessages(e)...)
+		}
+
+		return msgs
+	}
+
+	return []string{err.Error()}
+}
@@ -0,0 +1,1222 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/types"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kimor79/configo/internal/tags"
+)
+
+// configoPath is the import path of package configo, whose Secret fields
+// are treated as secrets.
+const configoPath = "github.com/kimor79/configo"
+
+// methods lists the methods declared on every generated type.
+var methods = []string{"ApplyDefaults", "ApplyEnv", "ApplyDerived", "CheckRules", "Configure"}
+
+// generator writes the loaders of the types of a package.
+type generator struct {
+	pkg *types.Package
+
+	// imports maps the paths of the imported packages to their names.
+	imports map[string]string
+	// helpers holds the helper functions used, by name.
+	helpers map[string]string
+	// regexps lists the patterns of the "regexp" rules, in order.
+	regexps []string
+
+	buf *bytes.Buffer
+	// visiting holds the nested struct types being walked, to refuse
+	// recursive types.
+	visiting map[string]bool
+}
+
+func newGenerator(pkg *types.Package) *generator {
+	return &generator{
+		pkg:      pkg,
+		buf:      new(bytes.Buffer),
+		imports:  map[string]string{"errors": "errors"},
+		helpers:  map[string]string{},
+		visiting: map[string]bool{},
+	}
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.buf, format, args...)
+}
+
+// capture returns what `fn` writes instead of writing it.
+func (g *generator) capture(fn func() error) (string, error) {
+	outer := g.buf
+	defer func() { g.buf = outer }()
+
+	g.buf = new(bytes.Buffer)
+	err := fn()
+	return g.buf.String(), err
+}
+
+// guard writes what `fn` writes in an if statement on `cond`, if anything.
+func (g *generator) guard(cond string, fn func() error) error {
+	inner, err := g.capture(fn)
+	if inner != "" {
+		g.printf("if %s {\n%s}\n", cond, inner)
+	}
+
+	return err
+}
+
+// use imports the package `path` of the standard library.
+func (g *generator) use(path string) {
+	g.imports[path] = path[strings.LastIndex(path, "/")+1:]
+}
+
+// helper adds the helper function `name` to the file and returns its name.
+func (g *generator) helper(name string) string {
+	h := helpers[name]
+	for _, path := range h.imports {
+		g.use(path)
+	}
+
+	g.helpers[name] = h.src
+	return name
+}
+
+// typeString returns `t` as written in the generated file.
+func (g *generator) typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		if p == g.pkg {
+			return ""
+		}
+
+		g.imports[p.Path()] = p.Name()
+		return p.Name()
+	})
+}
+
+// source returns the formatted file.
+func (g *generator) source() ([]byte, error) {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "// Code generated by configo-gen; DO NOT EDIT.\n\npackage %s\n\nimport (\n", g.pkg.Name())
+
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if name := g.imports[path]; name != path[strings.LastIndex(path, "/")+1:] {
+			fmt.Fprintf(&b, "\t%s %q\n", name, path)
+		} else {
+			fmt.Fprintf(&b, "\t%q\n", path)
+		}
+	}
+
+	b.WriteString(")\n")
+	b.Write(g.buf.Bytes())
+
+	names := make([]string, 0, len(g.helpers))
+	for name := range g.helpers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		b.WriteString("\n" + g.helpers[name])
+	}
+
+	if g.regexps != nil {
+		b.WriteString("\nvar (\n")
+		for i, re := range g.regexps {
+			fmt.Fprintf(&b, "configoRegexp%d = regexp.MustCompile(%q)\n", i, re)
+		}
+		b.WriteString(")\n")
+	}
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %s", err)
+	}
+
+	return src, nil
+}
+
+// generate writes the methods of the struct type `obj`.
+func (g *generator) generate(obj *types.TypeName) error {
+	t := obj.Type()
+	if _, ok := t.Underlying().(*types.Struct); !ok || obj.Pkg() != g.pkg {
+		return fmt.Errorf("not a struct type of package %s", g.pkg.Name())
+	}
+
+	for _, m := range methods {
+		if o, _, _ := types.LookupFieldOrMethod(t, true, g.pkg, m); o != nil {
+			return fmt.Errorf("%s is already declared", m)
+		}
+	}
+
+	name := obj.Name()
+
+	g.printf("\n// ApplyDefaults sets the unset fields of c to their \"default\" tag, as\n")
+	g.printf("// configo.FromDefaults does, except for derived defaults.\n")
+	g.printf("func (c *%s) ApplyDefaults() error {\nvar errs []error\n", name)
+	if err := g.defaults(t, "", "c"); err != nil {
+		return err
+	}
+	g.printf("return errors.Join(errs...)\n}\n")
+
+	g.printf("\n// ApplyEnv sets the fields of c from the environment variables named by\n")
+	g.printf("// their \"env\" and \"alias\" tags with `prefix` prepended, as\n")
+	g.printf("// configo.EnvConfigo does.\n")
+	g.printf("func (c *%s) ApplyEnv(prefix string) error {\nvar errs []error\n", name)
+	if err := g.env(t, "", "c"); err != nil {
+		return err
+	}
+	g.printf("return errors.Join(errs...)\n}\n")
+
+	g.printf("\n// ApplyDerived sets the unset fields of c with a derived default, such as\n")
+	g.printf("// `default:\"${.Host}:${.Port}\"`, from the fields it refers to.\n")
+	g.printf("func (c *%s) ApplyDerived() error {\nvar errs []error\n", name)
+	if err := g.derived(t, "", "c"); err != nil {
+		return err
+	}
+	g.printf("return errors.Join(errs...)\n}\n")
+
+	g.printf("\n// CheckRules checks the fields of c against their \"validate\" tag, as\n")
+	g.printf("// configo.Validate does.\n")
+	g.printf("func (c *%s) CheckRules() error {\nvar errs []error\n", name)
+	if err := g.validate(t, "", "c"); err != nil {
+		return err
+	}
+	g.printf("return errors.Join(errs...)\n}\n")
+
+	g.printf("\n// Configure loads c in the order of configo.UnmarshalFile: defaults, then\n")
+	g.printf("// `decode`, if not nil, then environment variables with `prefix`, then\n")
+	g.printf("// derived defaults, then rules, then the AfterLoad and Validate hooks.\n")
+	g.printf("// Every step runs even if an earlier one fails.\n")
+	g.printf("func (c *%s) Configure(decode func(*%s) error, prefix string) error {\n", name, name)
+	g.printf("errs := []error{c.ApplyDefaults()}\n")
+	g.printf("if decode != nil {\nerrs = append(errs, decode(c))\n}\n")
+	g.printf("errs = append(errs, c.ApplyEnv(prefix), c.ApplyDerived(), c.CheckRules())\n")
+	if err := g.hooks(t, "", "c", "AfterLoad"); err != nil {
+		return err
+	}
+	if err := g.hooks(t, "", "c", "Validate"); err != nil {
+		return err
+	}
+	g.printf("return errors.Join(errs...)\n}\n")
+
+	return nil
+}
+
+// field is an exported field of a struct being walked.
+type field struct {
+	name string
+	typ  types.Type
+	tag  reflect.StructTag
+	// path is the dotted path of Go field names from the root, e.g. "DB.Host".
+	path string
+	// expr is the field as a Go expression, e.g. "c.DB.Host".
+	expr string
+}
+
+// fields returns the exported fields of struct type `t`.
+func fields(t types.Type, path, expr string) []field {
+	st := t.Underlying().(*types.Struct)
+
+	var fs []field
+	for i := 0; i < st.NumFields(); i++ {
+		v := st.Field(i)
+		if !v.Exported() {
+			continue
+		}
+
+		fpath := v.Name()
+		if path != "" {
+			fpath = path + "." + fpath
+		}
+
+		fs = append(fs, field{
+			name: v.Name(),
+			typ:  v.Type(),
+			tag:  reflect.StructTag(st.Tag(i)),
+			path: fpath,
+			expr: expr + "." + v.Name(),
+		})
+	}
+
+	return fs
+}
+
+// nested reports whether the field `f` is a struct, or a pointer to one,
+// whose fields are walked rather than set as a whole, as isNested does. It
+// fails on recursive types, which cannot be walked ahead of time.
+func (g *generator) nested(f field) (elem types.Type, ptr bool, ok bool, err error) {
+	elem = f.typ
+	if p, isPtr := elem.Underlying().(*types.Pointer); isPtr {
+		elem, ptr = p.Elem(), true
+	}
+
+	if !isStructType(elem) {
+		return nil, false, false, nil
+	}
+
+	if g.visiting[elem.String()] {
+		return nil, false, false, fmt.Errorf("%s: recursive type %s is not supported", f.path, g.typeString(elem))
+	}
+
+	return elem, ptr, true, nil
+}
+
+// walk calls `fn` on the fields of struct `t` at `path` while visiting it.
+func (g *generator) walk(t types.Type, path, expr string, fn func(f field) error) error {
+	g.visiting[t.String()] = true
+	defer delete(g.visiting, t.String())
+
+	for _, f := range fields(t, path, expr) {
+		err := fn(f)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isStructType reports whether `t` is a struct with exported fields that
+// is not marshaled as text.
+func isStructType(t types.Type) bool {
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok || hasMethod(types.NewPointer(t), "MarshalText") {
+		return false
+	}
+
+	for i := 0; i < st.NumFields(); i++ {
+		if st.Field(i).Exported() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasMethod(t types.Type, name string) bool {
+	return types.NewMethodSet(t).Lookup(nil, name) != nil
+}
+
+// hasHook reports whether `t` has the method `name` of type func() error.
+func hasHook(t types.Type, name string) bool {
+	sel := types.NewMethodSet(t).Lookup(nil, name)
+	if sel == nil {
+		return false
+	}
+
+	sig := sel.Type().(*types.Signature)
+	return sig.Params().Len() == 0 && sig.Results().Len() == 1 &&
+		types.Identical(sig.Results().At(0).Type(), types.Universe.Lookup("error").Type())
+}
+
+// unmarshaler reports whether a field of type `t`, a pointer or not, is set
+// with UnmarshalText.
+func unmarshaler(t types.Type) bool {
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		t = p.Elem()
+	}
+
+	return hasMethod(types.NewPointer(t), "UnmarshalText")
+}
+
+// isSecret reports whether the field `f` holds a value that must not be
+// shown, because it is tagged `secret:"true"` or is a configo.Secret.
+func isSecret(f field) bool {
+	return f.tag.Get("secret") == "true" || isSecretType(f.typ)
+}
+
+func isSecretType(t types.Type) bool {
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		t = p.Elem()
+	}
+
+	n, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+
+	obj := n.Origin().Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == configoPath && obj.Name() == "Secret"
+}
+
+// zero returns the Go condition testing whether `x` of type `t` is its zero
+// value.
+func (g *generator) zero(x string, t types.Type) (string, error) {
+	return g.compareZero(x, t, "==")
+}
+
+// nonzero returns the Go condition testing whether `x` of type `t` is not
+// its zero value.
+func (g *generator) nonzero(x string, t types.Type) (string, error) {
+	return g.compareZero(x, t, "!=")
+}
+
+func (g *generator) compareZero(x string, t types.Type, op string) (string, error) {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsString != 0:
+			return x + " " + op + ` ""`, nil
+		case u.Info()&types.IsBoolean != 0 && op == "==":
+			return "!" + x, nil
+		case u.Info()&types.IsBoolean != 0:
+			return x, nil
+		case u.Info()&types.IsNumeric != 0:
+			return x + " " + op + " 0", nil
+		}
+	case *types.Pointer, *types.Slice, *types.Map, *types.Chan, *types.Signature, *types.Interface:
+		return x + " " + op + " nil", nil
+	case *types.Struct, *types.Array:
+		if types.Comparable(t) {
+			return fmt.Sprintf("%s %s (%s{})", x, op, g.typeString(t)), nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot tell if %s is unset", g.typeString(t))
+}
+
+// defaults writes the statements setting the defaults of the fields of
+// struct `t`, as setDefaults does.
+func (g *generator) defaults(t types.Type, path, expr string) error {
+	return g.walk(t, path, expr, func(f field) error {
+		elem, ptr, nested, err := g.nested(f)
+		if err != nil {
+			return err
+		}
+
+		if nested {
+			if !ptr {
+				return g.defaults(elem, f.path, f.expr)
+			}
+
+			inner, err := g.capture(func() error { return g.defaults(elem, f.path, f.expr) })
+
+			// Nil pointers are only allocated, as setDefaults does.
+			g.printf("if %s == nil {\n%s = new(%s)\n", f.expr, f.expr, g.typeString(elem))
+			if inner != "" {
+				g.printf("} else {\n%s", inner)
+			}
+			g.printf("}\n")
+			return err
+		}
+
+		def := f.tag.Get("default")
+
+		for _, name := range tags.BareRefs(def) {
+			if _, ok := fieldByPath(t, name); ok {
+				return fmt.Errorf("%s: default refers to a field without the leading dot: use ${.%s}", f.path, name)
+			}
+		}
+
+		if tags.IsDerived(def) || ignoresStrings(f.typ) {
+			def = ""
+		}
+
+		if p, ok := f.typ.Underlying().(*types.Pointer); ok {
+			g.printf("if %s == nil {\n%s = new(%s)\n", f.expr, f.expr, g.typeString(p.Elem()))
+			if def != "" {
+				err = g.setDefault(f, def)
+			}
+			g.printf("}\n")
+			return err
+		}
+
+		if def == "" {
+			return nil
+		}
+
+		cond, err := g.zero(f.expr, f.typ)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.path, err)
+		}
+
+		g.printf("if %s {\n", cond)
+		err = g.setDefault(f, def)
+		g.printf("}\n")
+		return err
+	})
+}
+
+// setDefault writes the statements setting the field `f`, allocated if a
+// pointer, to the default `def`. Defaults are converted when generating,
+// except for the types set with UnmarshalText.
+func (g *generator) setDefault(f field, def string) error {
+	if unmarshaler(f.typ) {
+		g.printf("if err := %s.UnmarshalText([]byte(%q)); err != nil {\n", f.expr, def)
+		g.printf("errs = append(errs, %s(\"default\", %q, %q, %t, err))\n}\n", g.helper("configoFieldError"), f.path, def, isSecret(f))
+		return nil
+	}
+
+	target, t := f.expr, f.typ
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		target, t = "*"+target, p.Elem()
+	}
+
+	lit, err := literal(t, def)
+	if err != nil {
+		return fmt.Errorf("%s: default %q: %w", f.path, def, err)
+	}
+
+	g.printf("%s = %s\n", target, lit)
+	return nil
+}
+
+// literal returns the string `s` converted to type `t` as a Go constant.
+func literal(t types.Type, s string) (string, error) {
+	b, ok := t.Underlying().(*types.Basic)
+	if !ok {
+		return "", fmt.Errorf("type %s is not supported", t)
+	}
+
+	info := b.Info()
+
+	switch {
+	case info&types.IsBoolean != 0:
+		v, err := strconv.ParseBool(s)
+		return strconv.FormatBool(v), err
+	case info&types.IsInteger != 0 && info&types.IsUnsigned != 0:
+		v, err := strconv.ParseUint(s, 10, bits(b))
+		return strconv.FormatUint(v, 10), err
+	case info&types.IsInteger != 0:
+		v, err := strconv.ParseInt(s, 10, bits(b))
+		return strconv.FormatInt(v, 10), err
+	case info&types.IsFloat != 0:
+		v, err := strconv.ParseFloat(s, bits(b))
+		if err == nil && (math.IsInf(v, 0) || math.IsNaN(v)) {
+			err = fmt.Errorf("%s is not a constant", s)
+		}
+
+		lit := strconv.FormatFloat(v, 'g', -1, bits(b))
+		if !strings.ContainsAny(lit, ".e") {
+			lit += ".0"
+		}
+
+		return lit, err
+	case info&types.IsString != 0:
+		return strconv.Quote(s), nil
+	}
+
+	return "", fmt.Errorf("type %s is not supported", t)
+}
+
+// bits returns the size of the basic type `b` as given to strconv, 0 for
+// int and uint.
+func bits(b *types.Basic) int {
+	switch b.Kind() {
+	case types.Int8, types.Uint8:
+		return 8
+	case types.Int16, types.Uint16:
+		return 16
+	case types.Int32, types.Uint32, types.Float32:
+		return 32
+	case types.Int64, types.Uint64, types.Float64:
+		return 64
+	}
+
+	return 0
+}
+
+// setString writes the statements setting the field `f` from the string
+// variable `s`, as set does. Errors are reported with the source `source`,
+// a Go expression, and the value `value`, a Go expression too. Empty
+// strings are zero for signed integers if `emptyZero` is set.
+func (g *generator) setString(f field, s, source, value string, emptyZero bool) error {
+	fail := fmt.Sprintf("errs = append(errs, %s(%s, %q, %s, %t, err))\n", g.helper("configoFieldError"), source, f.path, value, isSecret(f))
+
+	target, t := f.expr, f.typ
+	p, ptr := t.Underlying().(*types.Pointer)
+	if ptr {
+		t = p.Elem()
+		g.printf("if %s == nil {\n%s = new(%s)\n}\n", target, target, g.typeString(t))
+	}
+
+	if unmarshaler(f.typ) {
+		g.printf("if err := %s.UnmarshalText([]byte(%s)); err != nil {\n%s}\n", target, s, fail)
+		return nil
+	}
+
+	if ptr {
+		target = "*" + target
+	}
+
+	b, ok := t.Underlying().(*types.Basic)
+	if !ok {
+		return fmt.Errorf("%s: type %s is not supported", f.path, g.typeString(f.typ))
+	}
+
+	info := b.Info()
+
+	var parse, result string
+	switch {
+	case info&types.IsString != 0:
+		g.printf("%s = %s\n", target, convert(g.typeString(t), "string", s))
+		return nil
+	case info&types.IsBoolean != 0:
+		parse, result = fmt.Sprintf("strconv.ParseBool(%s)", s), "bool"
+	case info&types.IsInteger != 0 && info&types.IsUnsigned != 0:
+		parse, result = fmt.Sprintf("strconv.ParseUint(%s, 10, %d)", s, bits(b)), "uint64"
+	case info&types.IsInteger != 0:
+		if emptyZero && !ptr {
+			g.printf("if %s == \"\" {\n%s = \"0\"\n}\n", s, s)
+		}
+
+		parse, result = fmt.Sprintf("strconv.ParseInt(%s, 10, %d)", s, bits(b)), "int64"
+	case info&types.IsFloat != 0:
+		parse, result = fmt.Sprintf("strconv.ParseFloat(%s, %d)", s, bits(b)), "float64"
+	default:
+		return fmt.Errorf("%s: type %s is not supported", f.path, g.typeString(f.typ))
+	}
+
+	g.use("strconv")
+	g.printf("if v, err := %s; err != nil {\n%s} else {\n%s = %s\n}\n", parse, fail, target, convert(g.typeString(t), result, "v"))
+	return nil
+}
+
+// ignoresStrings reports whether fields of type `t`, slices and maps, are
+// only read from files, their "env" and "default" tags ignored, as
+// stringKindOf decides.
+func ignoresStrings(t types.Type) bool {
+	if p, ok := t.Underlying().(*types.Pointer); ok && !unmarshaler(t) {
+		return ignoresStrings(p.Elem())
+	}
+
+	switch t.Underlying().(type) {
+	case *types.Slice, *types.Map:
+		return !unmarshaler(t)
+	}
+
+	return false
+}
+
+// canFail reports whether setting a field of type `t` from a string can
+// fail, as it cannot for strings.
+func canFail(t types.Type) bool {
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		t = p.Elem()
+	}
+
+	b, ok := t.Underlying().(*types.Basic)
+	return unmarshaler(t) || !ok || b.Info()&types.IsString == 0
+}
+
+// convert converts `x` of type `from` to type `to`, unless they are the
+// same.
+func convert(to, from, x string) string {
+	if to == from {
+		return x
+	}
+
+	return to + "(" + x + ")"
+}
+
+// env writes the statements setting the fields of struct `t` from the
+// environment, as setEnv does.
+func (g *generator) env(t types.Type, path, expr string) error {
+	return g.walk(t, path, expr, func(f field) error {
+		elem, ptr, nested, err := g.nested(f)
+		if err != nil {
+			return err
+		}
+
+		if nested {
+			if !ptr {
+				return g.env(elem, f.path, f.expr)
+			}
+
+			return g.guard(f.expr+" != nil", func() error { return g.env(elem, f.path, f.expr) })
+		}
+
+		name := f.tag.Get("env")
+		_, aliases, err := tags.SplitAliases(f.tag.Get("alias"))
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.path, err)
+		}
+
+		deprecated := f.tag.Get("deprecated")
+
+		if name == "" && aliases == nil || ignoresStrings(f.typ) {
+			return nil
+		}
+
+		source := fmt.Sprintf("\"env:\"+prefix+%q", name)
+
+		if aliases == nil && deprecated == "" {
+			g.use("os")
+			g.printf("if s := os.Getenv(prefix + %q); s != \"\" {\n", name)
+		} else {
+			args := []string{"prefix", strconv.Quote(name), strconv.Quote(deprecated)}
+			for _, a := range aliases {
+				args = append(args, strconv.Quote(a))
+			}
+
+			source = `"env:"+name`
+
+			name := "name"
+			if !canFail(f.typ) {
+				name = "_"
+			}
+
+			g.printf("if %s, s := %s(%s); s != \"\" {\n", name, g.helper("configoLookupEnv"), strings.Join(args, ", "))
+		}
+
+		err = g.setString(f, "s", source, "s", false)
+		g.printf("}\n")
+		return err
+	})
+}
+
+// fieldByPath returns the fields of struct type `t` named by the dotted
+// path of Go field names `path`, one per name, as fieldByPath does.
+func fieldByPath(t types.Type, path string) ([]*types.Var, bool) {
+	return tags.FieldByPath(t, path, func(t types.Type, name string) (*types.Var, types.Type, bool) {
+		if p, ok := t.Underlying().(*types.Pointer); ok {
+			t = p.Elem()
+		}
+
+		if _, ok := t.Underlying().(*types.Struct); !ok {
+			return nil, nil, false
+		}
+
+		obj, index, indirect := types.LookupFieldOrMethod(t, false, nil, name)
+		v, ok := obj.(*types.Var)
+		if !ok || !v.Exported() || (len(index) > 1 && indirect) {
+			return nil, nil, false
+		}
+
+		return v, v.Type(), true
+	})
+}
+
+// derivedField is a field with a derived default.
+type derivedField struct {
+	field
+	def string
+	// deps lists the fields of the same struct the default refers to.
+	deps []string
+}
+
+// derived writes the statements evaluating the derived defaults of the
+// unset fields of struct `t`, as deriveDefaults does: those of nested
+// structs first, then the fields of `t` in an order where every default is
+// evaluated after the fields it refers to.
+func (g *generator) derived(t types.Type, path, expr string) error {
+	dfs := map[string]*derivedField{}
+
+	err := g.walk(t, path, expr, func(f field) error {
+		elem, ptr, nested, err := g.nested(f)
+		if err != nil {
+			return err
+		}
+
+		if nested {
+			if !ptr {
+				return g.derived(elem, f.path, f.expr)
+			}
+
+			return g.guard(f.expr+" != nil", func() error { return g.derived(elem, f.path, f.expr) })
+		}
+
+		def := f.tag.Get("default")
+		if !tags.IsDerived(def) || ignoresStrings(f.typ) {
+			return nil
+		}
+
+		if strings.Contains(def, "{{") {
+			return fmt.Errorf("%s: template defaults are not supported, use ${.Field} references", f.path)
+		}
+
+		df := &derivedField{field: f, def: def}
+		for _, m := range tags.DerivedRef.FindAllStringSubmatch(def, -1) {
+			if _, ok := fieldByPath(t, m[1]); !ok {
+				return fmt.Errorf("%s: default refers to an unknown field %s", f.path, m[1])
+			}
+
+			name, _, _ := strings.Cut(m[1], ".")
+			df.deps = append(df.deps, name)
+		}
+
+		dfs[f.name] = df
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	order, stuck := tags.DeriveOrder(dfs, func(df *derivedField) []string { return df.deps })
+	if stuck != nil {
+		return fmt.Errorf("%s: default depends on itself through other derived defaults", stuck[0].path)
+	}
+
+	for _, df := range order {
+		err = g.derive(t, expr, df)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// derive writes the statements evaluating the derived default of `df`, a
+// field of struct `t` at `expr`, if the field is unset.
+func (g *generator) derive(t types.Type, expr string, df *derivedField) error {
+	x, typ := df.expr, df.typ
+	cond := ""
+
+	if p, ok := typ.Underlying().(*types.Pointer); ok {
+		cond = x + " == nil || "
+		x, typ = "*"+x, p.Elem()
+	}
+
+	zero, err := g.zero(x, typ)
+	if err != nil {
+		return fmt.Errorf("%s: %w", df.path, err)
+	}
+
+	g.printf("if %s%s {\n", cond, zero)
+
+	var parts []string
+	last := 0
+
+	for i, m := range tags.DerivedRef.FindAllStringSubmatchIndex(df.def, -1) {
+		ref := df.def[m[2]:m[3]]
+
+		vars, _ := fieldByPath(t, ref)
+
+		if m[0] > last {
+			parts = append(parts, strconv.Quote(df.def[last:m[0]]))
+		}
+		last = m[1]
+
+		name := fmt.Sprintf("ref%d", i)
+
+		// Pointers on the way to the field leave the reference empty when
+		// nil, as valueByPath does.
+		var guards []string
+		rx := expr
+		for _, v := range vars {
+			rx += "." + v.Name()
+			if _, ok := v.Type().Underlying().(*types.Pointer); ok {
+				guards = append(guards, rx+" != nil")
+			}
+		}
+
+		ft := vars[len(vars)-1].Type()
+		if p, ok := ft.Underlying().(*types.Pointer); ok {
+			rx, ft = "*"+rx, p.Elem()
+		}
+
+		text := g.text(rx, ft)
+
+		if guards != nil {
+			g.printf("%s := \"\"\nif %s {\n%s = %s\n}\n", name, strings.Join(guards, " && "), name, text)
+		} else {
+			g.printf("%s := %s\n", name, text)
+		}
+
+		if m[4] >= 0 {
+			g.printf("if %s == \"\" {\n%s = %q\n}\n", name, name, df.def[m[4]:m[5]])
+		}
+
+		parts = append(parts, name)
+	}
+
+	if last < len(df.def) {
+		parts = append(parts, strconv.Quote(df.def[last:]))
+	}
+
+	g.printf("s := %s\n", strings.Join(parts, " + "))
+
+	err = g.setString(df.field, "s", `"default"`, strconv.Quote(df.def), true)
+	g.printf("}\n")
+	return err
+}
+
+// text returns the Go expression formatting `x` of type `t` for a derived
+// default, as interpText does.
+func (g *generator) text(x string, t types.Type) string {
+	if isSecretType(t) {
+		g.use("fmt")
+		return fmt.Sprintf("fmt.Sprint(%s.Get())", x)
+	}
+
+	if hasMethod(t, "MarshalText") {
+		return fmt.Sprintf("%s(%s)", g.helper("configoText"), x)
+	}
+
+	return g.show(x, t)
+}
+
+// show returns the Go expression formatting `x` of type `t` for an error,
+// as display does.
+func (g *generator) show(x string, t types.Type) string {
+	if b, ok := t.Underlying().(*types.Basic); ok && b.Info()&types.IsString != 0 && types.NewMethodSet(t).Len() == 0 {
+		return convert("string", g.typeString(t), x)
+	}
+
+	g.use("fmt")
+	return fmt.Sprintf("fmt.Sprint(%s)", x)
+}
+
+// validate writes the statements checking the fields of struct `t` against
+// their rules, as validate does.
+func (g *generator) validate(t types.Type, path, expr string) error {
+	return g.walk(t, path, expr, func(f field) error {
+		rules := tags.ParseRules(f.tag.Get("validate"))
+
+		if rules != nil {
+			x, typ, shown := f.expr, f.typ, ""
+
+			// Rules apply to the value pointed to, zero if nil.
+			p, ptr := typ.Underlying().(*types.Pointer)
+			if ptr {
+				x, typ, shown = "v", p.Elem(), "shown"
+				g.printf("{\nvar v %s\nshown := \"\"\nif %s != nil {\nv = *%s\nshown = %s\n}\n", g.typeString(typ), f.expr, f.expr, g.show("v", typ))
+			} else {
+				shown = g.show(x, typ)
+			}
+
+			// Rules apply to the value held by a Secret.
+			if isSecretType(typ) {
+				x, typ = x+".Get()", typ.(*types.Named).TypeArgs().At(0)
+			}
+
+			for _, r := range rules {
+				cond, err := g.broken(r, x, typ)
+				if err != nil {
+					return fmt.Errorf("%s: rule %s: %w", f.path, r, err)
+				}
+
+				g.printf("if %s {\n", cond)
+				g.printf("errs = append(errs, %s(\"validate\", %q, %s, %t, errors.New(%q)))\n}\n", g.helper("configoFieldError"), f.path, shown, isSecret(f), "failed rule "+r.String())
+			}
+
+			if ptr {
+				g.printf("}\n")
+			}
+		}
+
+		elem, ptr, nested, err := g.nested(f)
+		if err != nil || !nested {
+			return err
+		}
+
+		if !ptr {
+			return g.validate(elem, f.path, f.expr)
+		}
+
+		return g.guard(f.expr+" != nil", func() error { return g.validate(elem, f.path, f.expr) })
+	})
+}
+
+// broken returns the Go condition true when `x` of type `t` breaks the rule
+// `r`, as rule.holds decides.
+func (g *generator) broken(r tags.Rule, x string, t types.Type) (string, error) {
+	switch r.Name {
+	case "required":
+		return g.zero(x, t)
+	case "min", "max", "len":
+		return g.bound(r, x, t)
+	case "oneof", "regexp", "url", "hostport", "file_exists":
+	default:
+		return "", fmt.Errorf("unknown rule")
+	}
+
+	nonzero, err := g.nonzero(x, t)
+	if err != nil {
+		return "", err
+	}
+
+	b, _ := t.Underlying().(*types.Basic)
+	isString := b != nil && b.Info()&types.IsString != 0
+
+	if r.Name == "oneof" {
+		opts := strings.Split(r.Arg, "|")
+
+		if isString && types.NewMethodSet(t).Len() == 0 {
+			conds := make([]string, len(opts))
+			for i, opt := range opts {
+				conds[i] = fmt.Sprintf("%s != %q", x, opt)
+			}
+
+			return nonzero + " && " + strings.Join(conds, " && "), nil
+		}
+
+		g.use("fmt")
+
+		args := []string{fmt.Sprintf("fmt.Sprint(%s)", x)}
+		for _, opt := range opts {
+			args = append(args, strconv.Quote(opt))
+		}
+
+		return fmt.Sprintf("%s && !%s(%s)", nonzero, g.helper("configoOneOf"), strings.Join(args, ", ")), nil
+	}
+
+	if !isString {
+		return "", fmt.Errorf("not supported for %s", g.typeString(t))
+	}
+
+	s := convert("string", g.typeString(t), x)
+
+	switch r.Name {
+	case "regexp":
+		_, err := regexp.Compile(r.Arg)
+		if err != nil {
+			return "", err
+		}
+
+		g.use("regexp")
+		g.regexps = append(g.regexps, r.Arg)
+		return fmt.Sprintf("%s && !configoRegexp%d.MatchString(%s)", nonzero, len(g.regexps)-1, s), nil
+	case "url":
+		return fmt.Sprintf("%s && !%s(%s)", nonzero, g.helper("configoIsURL"), s), nil
+	case "hostport":
+		return fmt.Sprintf("%s && !%s(%s)", nonzero, g.helper("configoIsHostPort"), s), nil
+	}
+
+	return fmt.Sprintf("%s && !%s(%s)", nonzero, g.helper("configoFileExists"), s), nil
+}
+
+// bound returns the condition of the "min", "max" or "len" rule `r`, as
+// checkBound decides.
+func (g *generator) bound(r tags.Rule, x string, t types.Type) (string, error) {
+	bound, err := strconv.ParseFloat(r.Arg, 64)
+	if err != nil {
+		return "", err
+	}
+
+	if math.IsNaN(bound) || math.IsInf(bound, 0) {
+		return "", fmt.Errorf("bound %s is not a number", r.Arg)
+	}
+
+	op := map[string]string{"min": "<", "max": ">", "len": "!="}[r.Name]
+
+	var n string
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		if u.Info()&types.IsString != 0 {
+			n = "len(" + x + ")"
+			break
+		}
+
+		if u.Info()&(types.IsInteger|types.IsFloat) == 0 {
+			return "", fmt.Errorf("not supported for %s", g.typeString(t))
+		}
+
+		// Integers are compared to integral bounds that fit their type, and
+		// float64s to any bound, as they are. Others are compared as
+		// float64s, as checkBound does, so the bound is never converted to
+		// a type it overflows or loses precision in.
+		if u.Kind() == types.Float64 || fits(u, bound) {
+			return fmt.Sprintf("%s %s %s", x, op, formatBound(bound)), nil
+		}
+
+		return fmt.Sprintf("float64(%s) %s %s", x, op, formatBound(bound)), nil
+	case *types.Slice, *types.Map, *types.Array:
+		n = "len(" + x + ")"
+	default:
+		return "", fmt.Errorf("not supported for %s", g.typeString(t))
+	}
+
+	// Lengths are compared to bounds that are not ints as float64s.
+	if !fits(types.Typ[types.Int], bound) {
+		n = "float64(" + n + ")"
+	}
+
+	return fmt.Sprintf("%s %s %s", n, op, formatBound(bound)), nil
+}
+
+// fits reports whether `bound` is an integer of the range of `b`, int and
+// uint taken as 32 bits wide.
+func fits(b *types.Basic, bound float64) bool {
+	if bound != math.Trunc(bound) || b.Info()&types.IsInteger == 0 {
+		return false
+	}
+
+	size := bits(b)
+	if size == 0 {
+		size = 32
+	}
+
+	if b.Info()&types.IsUnsigned != 0 {
+		return bound >= 0 && bound <= math.Pow(2, float64(size))-1
+	}
+
+	return bound >= -math.Pow(2, float64(size-1)) && bound <= math.Pow(2, float64(size-1))-1
+}
+
+func formatBound(bound float64) string {
+	return strconv.FormatFloat(bound, 'f', -1, 64)
+}
+
+// hooks writes the calls to the hook `name` of struct `t` and the structs
+// nested in it, nested first, as runHooks does.
+func (g *generator) hooks(t types.Type, path, expr, name string) error {
+	err := g.walk(t, path, expr, func(f field) error {
+		elem, ptr, nested, err := g.nested(f)
+		if err != nil || !nested {
+			return err
+		}
+
+		if !ptr {
+			return g.hooks(elem, f.path, f.expr, name)
+		}
+
+		return g.guard(f.expr+" != nil", func() error { return g.hooks(elem, f.path, f.expr, name) })
+	})
+	if err != nil {
+		return err
+	}
+
+	if !hasHook(types.NewPointer(t), name) {
+		return nil
+	}
+
+	g.printf("if err := %s.%s(); err != nil {\nerrs = append(errs, %s(%q, %q, \"\", false, err))\n}\n", expr, name, g.helper("configoFieldError"), name, path)
+	return nil
+}
+
+// helperFunc is a function added to the generated file when used.
+type helperFunc struct {
+	imports []string
+	src     string
+}
+
+var helpers = map[string]helperFunc{
+	"configoFieldError": {[]string{"fmt", "strings"}, `
+// configoFieldError describes a failure to set or check the field at path,
+// as a *configo.FieldError does. Secret values are masked.
+func configoFieldError(source, path, value string, secret bool, err error) error {
+	if secret {
+		if value != "" {
+			err = errors.New(strings.ReplaceAll(err.Error(), value, "******"))
+		}
+
+		value = "******"
+	}
+
+	return fmt.Errorf("%s %s=%q: %w", source, path, value, err)
+}
+`},
+	"configoLookupEnv": {[]string{"os"}, `
+// configoLogf, if set, receives the warnings about aliases and deprecated
+// environment variables, e.g. configoLogf = log.Printf. Without it they are
+// dropped, as configo.EnvConfigo drops them without a Logger.
+var configoLogf func(format string, v ...interface{})
+
+// configoLookupEnv returns the variable setting a field and its value, as
+// configo.EnvConfigo does: the variable env, or else the first of aliases
+// that is set. Aliases and deprecated variables found are warned about.
+func configoLookupEnv(prefix, env, deprecated string, aliases ...string) (name, value string) {
+	logf := func(format string, v ...interface{}) {
+		if configoLogf != nil {
+			configoLogf(format, v...)
+		}
+	}
+
+	warn := func(name, replacement string) {
+		s := "configo: environment variable " + name + " is deprecated"
+		if replacement != "" {
+			s += ", use " + replacement
+		}
+
+		if deprecated != "" {
+			s += ": " + deprecated
+		}
+
+		logf("%s", s)
+	}
+
+	if env != "" {
+		name = prefix + env
+		value = os.Getenv(name)
+
+		if value != "" && deprecated != "" {
+			warn(name, "")
+		}
+	}
+
+	for _, alias := range aliases {
+		aname := prefix + alias
+
+		avalue := os.Getenv(aname)
+		if avalue == "" {
+			continue
+		}
+
+		if value != "" {
+			logf("configo: environment variable %s is ignored since %s is set", aname, name)
+			continue
+		}
+
+		warn(aname, name)
+		name, value = aname, avalue
+	}
+
+	return name, value
+}
+`},
+	"configoText": {[]string{"encoding", "fmt"}, `
+// configoText formats m for a derived default.
+func configoText(m encoding.TextMarshaler) string {
+	b, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprint(m)
+	}
+
+	return string(b)
+}
+`},
+	"configoOneOf": {nil, `
+func configoOneOf(s string, opts ...string) bool {
+	for _, opt := range opts {
+		if s == opt {
+			return true
+		}
+	}
+
+	return false
+}
+`},
+	"configoIsURL": {[]string{"net/url"}, `
+func configoIsURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && (u.Host != "" || u.Path != "" || u.Opaque != "")
+}
+`},
+	"configoIsHostPort": {[]string{"net", "strconv"}, `
+func configoIsHostPort(s string) bool {
+	_, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return false
+	}
+
+	n, err := strconv.ParseUint(port, 10, 16)
+	return err == nil && n > 0
+}
+`},
+	"configoFileExists": {[]string{"os"}, `
+func configoFileExists(s string) bool {
+	_, err := os.Stat(s)
+	return err == nil
+}
+`},
+}
@@ -0,0 +1,196 @@
+// Package gen implements configo-gen, which generates reflection-free
+// loaders for config structs.
+//
+// Usage:
+//
+//	configo-gen -type T[,T...] [-o FILE] [DIR]
+//
+// configo-gen reads the package in DIR, "." by default, and writes FILE,
+// configo_gen.go in DIR by default, declaring these methods on each struct
+// type T:
+//
+//	ApplyDefaults() error        sets unset fields to their "default" tag, as FromDefaults
+//	ApplyEnv(prefix string) error sets fields from their "env" and "alias" tags, as FromEnv
+//	ApplyDerived() error         evaluates the derived defaults, e.g. `default:"${.Host}:${.Port}"`
+//	CheckRules() error           checks the "validate" tags, as Validate
+//	Configure(decode func(*T) error, prefix string) error
+//
+// Configure runs them in the order of UnmarshalFile, with `decode`, e.g. a
+// TOML decoder, in place of the file, then calls the AfterLoad and Validate
+// hooks of the structs implementing them. Warnings about aliases and
+// deprecated environment variables go to the configoLogf variable declared
+// in the generated file, if the package sets it. Interpolation and secret
+// references are not supported, nor are template defaults, e.g.
+// `default:"{{.Dir}}/cache"`.
+//
+// The generated code only imports the standard library and the packages of
+// the field types, so it builds where reflection is limited, e.g. with
+// TinyGo. Errors are joined with errors.Join rather than collected in a
+// *configo.LoadErrors, but read the same. All the types of a package must
+// be generated in one file, since the file declares helpers of its own.
+//
+// Run it from a go:generate directive next to the type:
+//
+//	//go:generate go run github.com/kimor79/configo/cmd/configo-gen -type Config
+package gen
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultOutput is the file written in the package directory when no
+// output file is given.
+const DefaultOutput = "configo_gen.go"
+
+const usage = `usage: configo-gen -type T[,T...] [-o FILE] [DIR]
+`
+
+// Run runs the configo-gen command with the arguments `args`, without the
+// program name, and returns its exit status.
+func Run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("configo-gen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+
+	typeNames := fs.String("type", "", "comma separated struct types to generate loaders for")
+	output := fs.String("o", "", "output file, "+DefaultOutput+" in DIR by default")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+
+		return 2
+	}
+
+	if *typeNames == "" || fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	dir := "."
+	if fs.NArg() == 1 {
+		dir = fs.Arg(0)
+	}
+
+	out := *output
+	if out == "" {
+		out = filepath.Join(dir, DefaultOutput)
+	}
+
+	src, err := Generate(dir, filepath.Base(out), strings.Split(*typeNames, ",")...)
+	if err == nil {
+		err = os.WriteFile(out, src, 0o644)
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "configo-gen: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// Generate returns the source of a Go file declaring the loaders of the
+// struct types `typeNames` of the package in the directory `dir`. The file
+// `output` of the package, if any, is ignored while reading it, so loaders
+// generated before are replaced rather than clash with the new ones.
+func Generate(dir, output string, typeNames ...string) ([]byte, error) {
+	pkg, err := loadPackage(dir, output)
+	if err != nil {
+		return nil, err
+	}
+
+	g := newGenerator(pkg)
+
+	for _, name := range typeNames {
+		name = strings.TrimSpace(name)
+
+		obj, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok {
+			return nil, fmt.Errorf("no type %s in package %s", name, pkg.Name())
+		}
+
+		err = g.generate(obj)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return g.source()
+}
+
+// loadPackage parses and type-checks the package in `dir`, leaving out its
+// test files and the file `skip`. Type errors are ignored, since the
+// package may use the loaders that are about to be generated.
+func loadPackage(dir, skip string) (*types.Package, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+
+	for _, name := range bp.GoFiles {
+		if name == skip {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, f)
+	}
+
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "gc", exportData(dir)),
+		Error:    func(error) {},
+	}
+
+	pkg, _ := conf.Check(bp.ImportPath, fset, files, nil)
+	if pkg == nil {
+		return nil, fmt.Errorf("cannot type-check %s", dir)
+	}
+
+	return pkg, nil
+}
+
+// exportData returns a lookup function for importer.ForCompiler, reading
+// the export data of packages as built by the go command from `dir`.
+func exportData(dir string) func(path string) (io.ReadCloser, error) {
+	return func(path string) (io.ReadCloser, error) {
+		cmd := exec.Command("go", "list", "-export", "-f", "{{.Export}}", path)
+		cmd.Dir = dir
+
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("go list %s: %s", path, strings.TrimSpace(stderr.String()))
+		}
+
+		f := strings.TrimSpace(string(out))
+		if f == "" {
+			return nil, fmt.Errorf("go list %s: no export data", path)
+		}
+
+		return os.Open(f)
+	}
+}
@@ -0,0 +1,68 @@
+package gen
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kimor79/configo/internal/tags/tagstest"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite the generated files in testdata")
+
+func TestGenerate(t *testing.T) {
+	golden := filepath.Join("testdata", "app", DefaultOutput)
+
+	src, err := Generate(filepath.Join("testdata", "app"), DefaultOutput, "Config")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if *update {
+		assert.NoError(t, os.WriteFile(golden, src, 0o644))
+	}
+
+	want, err := os.ReadFile(golden)
+	assert.NoError(t, err)
+	assert.Equal(t, string(want), string(src))
+}
+
+func TestGenerateErrors(t *testing.T) {
+	_, err := Generate(filepath.Join("testdata", "template"), DefaultOutput, "Config")
+	assert.EqualError(t, err, "Config: Cache: template defaults are not supported, use ${.Field} references")
+
+	_, err = Generate(filepath.Join("testdata", "alias"), DefaultOutput, "Config")
+	assert.EqualError(t, err, `Config: DSN: invalid alias "MYSQL_DSN": prefix it with "env:" for an environment variable or "toml:" for a TOML key`)
+
+	_, err = Generate(filepath.Join("testdata", "bareref"), DefaultOutput, "Config")
+	assert.EqualError(t, err, "Config: Addr: default refers to a field without the leading dot: use ${.Host}")
+
+	_, err = Generate(filepath.Join("testdata", "recursive"), DefaultOutput, "Config")
+	assert.EqualError(t, err, "Config: Root.Next: recursive type Node is not supported")
+
+	_, err = Generate(filepath.Join("testdata", "app"), DefaultOutput, "Mode")
+	assert.EqualError(t, err, "Mode: not a struct type of package app")
+
+	_, err = Generate(filepath.Join("testdata", "app"), DefaultOutput, "Missing")
+	assert.EqualError(t, err, "no type Missing in package app")
+
+	// Without skipping the generated file, the methods already exist.
+	_, err = Generate(filepath.Join("testdata", "app"), "", "Config")
+	assert.EqualError(t, err, "Config: ApplyDefaults is already declared")
+}
+
+func TestFieldByPath(t *testing.T) {
+	pkg, err := loadPackage(filepath.Join("..", "internal", "tags", "tagstest"), "")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	typ := pkg.Scope().Lookup("Fields").Type()
+
+	for path, want := range tagstest.FieldPaths {
+		_, ok := fieldByPath(typ, path)
+		assert.Equal(t, want, ok, path)
+	}
+}
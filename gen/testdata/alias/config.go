@@ -0,0 +1,5 @@
+package alias
+
+type Config struct {
+	DSN string `toml:"dsn" env:"DSN" alias:"mysql.dsn,MYSQL_DSN"`
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/kimor79/configo"
+)
+
+type Mode string
+
+type Config struct {
+	Listen  string                 `toml:"listen" env:"LISTEN" default:"127.0.0.1:8080" validate:"required,hostport"`
+	Mode    Mode                   `toml:"mode" env:"MODE" default:"prod" validate:"oneof=dev|prod"`
+	Workers int                    `toml:"workers" env:"WORKERS" alias:"env:THREADS" default:"4" validate:"min=1,max=64"`
+	Ratio   float64                `toml:"ratio" env:"RATIO" default:"0.5" validate:"max=1"`
+	Scale   float32                `toml:"scale" env:"SCALE" validate:"min=0.1,max=1e40"`
+	Debug   *bool                  `toml:"debug" env:"DEBUG"`
+	Timeout time.Duration          `toml:"timeout" env:"TIMEOUT" default:"30"`
+	Bind    net.IP                 `toml:"bind" env:"BIND" default:"0.0.0.0"`
+	Name    string                 `toml:"name" default:"${.Mode}-app" validate:"regexp=^[a-z-]+$"`
+	APIKey  configo.Secret[string] `toml:"api_key" env:"API_KEY" validate:"min=8"`
+
+	DB      Database          `toml:"db"`
+	Replica *Database         `toml:"replica"`
+	Tags    []string          `toml:"tags" validate:"max=8"`
+	Peers   []string          `toml:"peers" env:"PEERS" default:"a,b"`
+	Labels  map[string]string `toml:"labels" env:"LABELS"`
+
+	internal int
+}
+
+type Database struct {
+	Host     string  `toml:"host" env:"DB_HOST" default:"localhost" validate:"required"`
+	Port     *uint16 `toml:"port" env:"DB_PORT" default:"5432"`
+	User     string  `toml:"user" env:"DB_USER" alias:"env:DB_USERNAME" deprecated:"use a DSN"`
+	Password string  `toml:"password" env:"DB_PASSWORD" secret:"true"`
+	DSN      string  `toml:"dsn" default:"postgres://${.User}@${.Host}:${.Port:-5432}" validate:"url"`
+}
+
+func (d *Database) AfterLoad() error {
+	return nil
+}
+
+func (c *Config) Validate() error {
+	if c.Mode == "dev" && c.Listen == "0.0.0.0:80" {
+		return errors.New("dev mode must not listen publicly")
+	}
+
+	return nil
+}
@@ -0,0 +1,6 @@
+package bareref
+
+type Config struct {
+	Host string `default:"localhost"`
+	Addr string `default:"${Host}:5432"`
+}
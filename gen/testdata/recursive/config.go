@@ -0,0 +1,10 @@
+package recursive
+
+type Config struct {
+	Root Node `toml:"root"`
+}
+
+type Node struct {
+	Name string `toml:"name" default:"root"`
+	Next *Node  `toml:"next"`
+}
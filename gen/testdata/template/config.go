@@ -0,0 +1,6 @@
+package template
+
+type Config struct {
+	Dir   string `default:"/var/lib/app"`
+	Cache string `default:"{{.Dir}}/cache"`
+}
@@ -0,0 +1,49 @@
+package configo
+
+import "sync/atomic"
+
+// Holder stores the current config of type T so that any number of
+// goroutines can read it without locking while a loader swaps in new
+// versions.
+//
+// A config handed to a Holder must not be modified afterwards; a reload
+// builds a new one and stores it as a whole.
+type Holder[T any] struct {
+	p atomic.Pointer[T]
+}
+
+// NewHolder returns a Holder initially holding `v`, which may be nil.
+func NewHolder[T any](v *T) *Holder[T] {
+	h := &Holder[T]{}
+	h.p.Store(v)
+	return h
+}
+
+// Get returns the current config, or nil if none was stored yet.
+func (h *Holder[T]) Get() *T {
+	return h.p.Load()
+}
+
+// Store replaces the current config with `v`.
+func (h *Holder[T]) Store(v *T) {
+	h.p.Store(v)
+}
+
+// Swap replaces the current config with `v` and returns the previous one.
+func (h *Holder[T]) Swap(v *T) *T {
+	return h.p.Swap(v)
+}
+
+// Load loads a fresh config through `chain` and stores it. On failure the
+// current config is kept.
+func (h *Holder[T]) Load(chain *ConfigoChain) error {
+	next := new(T)
+
+	err := chain.Load(next)
+	if err != nil {
+		return err
+	}
+
+	h.p.Store(next)
+	return nil
+}
@@ -0,0 +1,76 @@
+package configo
+
+import "reflect"
+
+// Validator is implemented by config structs that check rules spanning
+// several fields, e.g. "TLS key required when TLS cert is set".
+type Validator interface {
+	Validate() error
+}
+
+// Finalizer is implemented by config structs that derive fields once every
+// source has been applied, e.g. a DSN built from host, port and user.
+type Finalizer interface {
+	AfterLoad() error
+}
+
+// runHooks calls AfterLoad on every Finalizer in `v`, then Validate on every
+// Validator. Nested structs are visited before the struct containing them.
+// Failures are reported as a *FieldError with the path of the struct, empty
+// for `v` itself, and the hook as its source.
+func runHooks(v interface{}) error {
+	rv := reflect.ValueOf(v).Elem()
+
+	var errs LoadErrors
+
+	walkHooks(rv, "", &errs, func(i interface{}) (string, error) {
+		if f, ok := i.(Finalizer); ok {
+			return "AfterLoad", f.AfterLoad()
+		}
+
+		return "", nil
+	})
+
+	walkHooks(rv, "", &errs, func(i interface{}) (string, error) {
+		if vr, ok := i.(Validator); ok {
+			return "Validate", vr.Validate()
+		}
+
+		return "", nil
+	})
+
+	return errs.err()
+}
+
+func walkHooks(v reflect.Value, path string, errs *LoadErrors, call func(interface{}) (string, error)) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+
+		walkHooks(v.Elem(), path, errs, call)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			val := v.Field(i)
+			typ := v.Type().Field(i)
+
+			if typ.PkgPath != "" {
+				continue
+			}
+
+			if isNested(val) {
+				walkHooks(val, joinPath(path, typ.Name), errs, call)
+			}
+		}
+
+		if !v.CanAddr() {
+			return
+		}
+
+		name, err := call(v.Addr().Interface())
+		if err != nil {
+			errs.add(&FieldError{Path: path, Source: name, Err: err})
+		}
+	}
+}
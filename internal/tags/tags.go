@@ -0,0 +1,195 @@
+// Package tags parses the struct tags of configo, for both the loaders of
+// package configo and the code generated by configo-gen.
+package tags
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rule is a rule of a "validate" tag, e.g. "max=64".
+type Rule struct {
+	Name string
+	Arg  string
+}
+
+func (r Rule) String() string {
+	if r.Arg == "" {
+		return r.Name
+	}
+
+	return r.Name + "=" + r.Arg
+}
+
+// ParseRules parses the "validate" tag `tag`, a comma separated list of
+// rules. A "regexp" rule takes the rest of the tag, commas included.
+func ParseRules(tag string) []Rule {
+	var rules []Rule
+
+	for tag != "" {
+		var s string
+		if strings.HasPrefix(tag, "regexp=") {
+			s, tag = tag, ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			s, tag = tag[:i], tag[i+1:]
+		} else {
+			s, tag = tag, ""
+		}
+
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		r := Rule{Name: s}
+		if i := strings.Index(s, "="); i >= 0 {
+			r = Rule{Name: s[:i], Arg: s[i+1:]}
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules
+}
+
+// DerivedRef matches a "${.Name}" or "${.Name:-fallback}" reference of a
+// derived default.
+var DerivedRef = regexp.MustCompile(`\$\{\.([^}:]+)(?::-([^}]*))?\}`)
+
+// IsDerived reports whether the "default" tag `tag` is a derived default: a
+// template, or a tag with a "${.Name}" reference to a Go field path.
+func IsDerived(tag string) bool {
+	return strings.Contains(tag, "{{") || DerivedRef.MatchString(tag)
+}
+
+// bareRef matches a "${Name}" or "${Name:-fallback}" reference without the
+// leading dot of a reference to a field.
+var bareRef = regexp.MustCompile(`\$\{([^.}:][^}:]*)(?::-[^}]*)?\}`)
+
+// BareRefs returns the names of the references of the "default" tag `tag`
+// without the leading dot, e.g. "Host" for "${Host}:${.Port}". Those naming
+// a field are mistakes for "${.Name}".
+func BareRefs(tag string) []string {
+	var names []string
+	for _, m := range bareRef.FindAllStringSubmatch(tag, -1) {
+		names = append(names, m[1])
+	}
+
+	return names
+}
+
+// SplitAliases splits the "alias" tag `tag` into TOML keys and environment
+// variables. An alias that is not a valid name is reported and left out, as
+// is an unprefixed alias in upper case, e.g. "MYSQL_DSN": it is more likely
+// meant as an environment variable than as a TOML key, so it must say which
+// it is.
+func SplitAliases(tag string) (keys, envs []string, err error) {
+	for _, a := range strings.Split(tag, ",") {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+
+		if env, ok := strings.CutPrefix(a, "env:"); ok {
+			env = strings.TrimSpace(env)
+			if env == "" || strings.ContainsAny(env, "= \t") {
+				err = fmt.Errorf("%w %q: not an environment variable", ErrAlias, a)
+				continue
+			}
+
+			envs = append(envs, env)
+			continue
+		}
+
+		key, prefixed := strings.CutPrefix(a, "toml:")
+		key = strings.TrimSpace(key)
+
+		switch {
+		case !tomlKeyPattern.MatchString(key):
+			err = fmt.Errorf("%w %q: not a dotted TOML key", ErrAlias, a)
+		case !prefixed && envLike.MatchString(key):
+			err = fmt.Errorf("%w %q: prefix it with \"env:\" for an environment variable or \"toml:\" for a TOML key", ErrAlias, a)
+		default:
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, envs, err
+}
+
+var (
+	// ErrAlias is wrapped by the error of an invalid alias.
+	ErrAlias = errors.New("invalid alias")
+
+	// tomlKeyPattern matches a dotted TOML key of bare or quoted keys.
+	tomlKeyPattern = regexp.MustCompile(`^(?:[A-Za-z0-9_-]+|"[^"]*"|'[^']*')(?:\s*\.\s*(?:[A-Za-z0-9_-]+|"[^"]*"|'[^']*'))*$`)
+	// envLike matches an upper case name, the way environment variables
+	// are named.
+	envLike = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+)
+
+// FieldByPath returns the fields named by the dotted path of Go field names
+// `path`, one per name, starting from the struct type `t`. `field` returns
+// the exported field `name` of type `t` and the type of the field, or false
+// if `t` is not a struct, or a pointer to one, with such a field.
+func FieldByPath[T, F any](t T, path string, field func(t T, name string) (F, T, bool)) ([]F, bool) {
+	var fields []F
+
+	for _, name := range strings.Split(path, ".") {
+		f, ft, ok := field(t, name)
+		if !ok {
+			return nil, false
+		}
+
+		fields = append(fields, f)
+		t = ft
+	}
+
+	return fields, true
+}
+
+// DeriveOrder sorts `fields` so every field follows the fields it depends
+// on, as listed by `deps`. Fields depending on each other in a cycle,
+// directly or not, are returned as `stuck`.
+func DeriveOrder[F any](fields map[string]F, deps func(f F) []string) (order, stuck []F) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	done := map[string]bool{}
+
+	for progress := true; progress; {
+		progress = false
+
+	next:
+		for _, name := range names {
+			if done[name] {
+				continue
+			}
+
+			for _, dep := range deps(fields[name]) {
+				if _, ok := fields[dep]; ok && !done[dep] {
+					continue next
+				}
+			}
+
+			done[name] = true
+			order = append(order, fields[name])
+			progress = true
+		}
+	}
+
+	for _, name := range names {
+		if !done[name] {
+			stuck = append(stuck, fields[name])
+		}
+	}
+
+	return order, stuck
+}
@@ -0,0 +1,40 @@
+// Package tagstest holds the cases shared by the tests of package configo
+// and configo-gen, so the reflect and go/types sides of package tags are
+// checked against the same table.
+package tagstest
+
+// Fields is the struct the FieldPaths are looked up in.
+type Fields struct {
+	Name  string
+	Inner Inner
+	Ptr   *Inner
+	Embedded
+
+	hidden string
+}
+
+type Inner struct {
+	Host string
+	Port int
+}
+
+type Embedded struct {
+	Promoted string
+}
+
+// FieldPaths maps dotted paths of Go field names to whether they name an
+// exported field of Fields.
+var FieldPaths = map[string]bool{
+	"Name":              true,
+	"Inner":             true,
+	"Inner.Host":        true,
+	"Ptr.Port":          true,
+	"Embedded.Promoted": true,
+	"Promoted":          true,
+	"hidden":            false,
+	"Missing":           false,
+	"Inner.Missing":     false,
+	"Name.Len":          false,
+	"Inner.Host.Len":    false,
+	"":                  false,
+}
@@ -0,0 +1,308 @@
+package configo
+
+import (
+	"encoding"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// InterpolateConfigo expands references in the string values of the merged
+// config that were read from TOML files. It is meant to follow every other
+// source of a ConfigoChain, and to precede ValidateConfigo; the chain then
+// tracks where values came from so that values set by the caller, by
+// defaults or by the environment are left as they are. Outside a chain, Load
+// expands every string field as Interpolate does.
+type InterpolateConfigo struct{}
+
+func NewInterpolateConfigo() *InterpolateConfigo { return &InterpolateConfigo{} }
+
+func (ic *InterpolateConfigo) merged() {}
+
+func (ic *InterpolateConfigo) Load(v interface{}) error {
+	return Interpolate(v)
+}
+
+func (ic *InterpolateConfigo) loadOrigins(v interface{}, p Provenance) error {
+	return interpolate(v, func(path string) bool { return p[path].Source == "toml" })
+}
+
+// Interpolate expands the references in every string field of pointer `v`,
+// whatever source set it. The following references are supported:
+//
+//	${NAME}            the environment variable NAME
+//	${NAME:-fallback}  NAME, or fallback when NAME is unset or empty
+//	${.host}           the value of another field, named by its dotted TOML key path
+//	${.db.host}        from the root of the file
+//
+// A reference starting with a dot names a field, anything else a variable.
+// Fields are referenced with the leading dot, ${.db.host}, rather than as
+// ${db.host}, so they are never mistaken for variables. A reference without
+// the dot that matches a key while no such variable is set is reported with
+// a hint to add the dot. Keys are matched case-insensitively and fallbacks
+// apply to fields as well.
+// Fields referenced by a field are expanded first, so references may be
+// chained but not form a cycle. "$${" is written as a literal "${".
+//
+// The returned error is a *LoadErrors holding a *FieldError for every field
+// that cannot be expanded: its references form a cycle, name an unset
+// variable without a fallback, or name a key matching no field, in which
+// case ErrUnknownKey is wrapped.
+func Interpolate(v interface{}) error {
+	return interpolate(v, nil)
+}
+
+// interpolate expands the string fields of `v` whose path `expand` accepts,
+// or all of them if it is nil. Other fields may still be referenced.
+func interpolate(v interface{}, expand func(path string) bool) error {
+	rv, err := target(v)
+	if err != nil {
+		return err
+	}
+
+	ip := &interpolation{keys: map[string]*interpField{}, only: expand}
+	collectInterp(rv, "", "", ip)
+
+	for _, f := range ip.fields {
+		if f.str {
+			ip.resolve(f)
+		}
+	}
+
+	return ip.errs.err()
+}
+
+// interpField is a leaf field that may be referenced or expanded.
+type interpField struct {
+	path   string
+	key    string
+	val    reflect.Value
+	secret bool
+	// str is set for the string fields that are expanded.
+	str bool
+
+	// state is 0 until the field is visited, 1 while its references are
+	// expanded and 2 once it is done.
+	state  int
+	result string
+	err    error
+}
+
+// interpolation holds the state of a single run of Interpolate.
+type interpolation struct {
+	fields []*interpField
+	keys   map[string]*interpField
+	only   func(path string) bool
+	errs   LoadErrors
+	// stack lists the keys being expanded, to report cycles.
+	stack []string
+}
+
+func collectInterp(v reflect.Value, path, key string, ip *interpolation) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+
+		collectInterp(v.Elem(), path, key, ip)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			val := v.Field(i)
+			typ := v.Type().Field(i)
+
+			if typ.PkgPath != "" {
+				continue
+			}
+
+			fpath := joinPath(path, typ.Name)
+			fkey := joinPath(key, tomlName(typ))
+
+			if isNested(val) {
+				collectInterp(val, fpath, fkey, ip)
+				continue
+			}
+
+			val = indirect(val)
+			if !val.IsValid() {
+				continue
+			}
+
+			str := isInterpString(val) && (ip.only == nil || ip.only(fpath))
+
+			f := &interpField{path: fpath, key: fkey, val: val, secret: isSecret(typ), str: str}
+			ip.fields = append(ip.fields, f)
+			ip.keys[fkey] = f
+		}
+	}
+}
+
+// isInterpString reports whether `v` holds a string to be expanded, either
+// directly or in a Secret.
+func isInterpString(v reflect.Value) bool {
+	if sv, ok := v.Interface().(secretValue); ok {
+		_, ok = sv.secret().(string)
+		return ok && v.CanAddr()
+	}
+
+	return v.Kind() == reflect.String && v.CanSet()
+}
+
+// resolve expands the references of field `f`, unless already done, and
+// returns its value as text.
+func (ip *interpolation) resolve(f *interpField) (string, error) {
+	switch f.state {
+	case 1:
+		cycle := append(ip.stack[indexOf(ip.stack, f.key):], f.key)
+		return "", fmt.Errorf("reference cycle %s", strings.Join(cycle, " -> "))
+	case 2:
+		return f.result, f.err
+	}
+
+	if !f.str {
+		f.state = 2
+		f.result = interpText(f.val)
+		return f.result, nil
+	}
+
+	f.state = 1
+	ip.stack = append(ip.stack, f.key)
+
+	raw := interpText(f.val)
+	f.result, f.err = ip.expand(raw)
+
+	ip.stack = ip.stack[:len(ip.stack)-1]
+	f.state = 2
+
+	if f.err != nil {
+		ip.errs.add(newFieldError(f.path, "interpolate", raw, f.secret, f.err))
+		return "", f.err
+	}
+
+	if f.result != raw {
+		f.err = setInterp(f.val, f.result)
+		if f.err != nil {
+			ip.errs.add(newFieldError(f.path, "interpolate", raw, f.secret, f.err))
+		}
+	}
+
+	return f.result, f.err
+}
+
+// expand replaces the references in `s`.
+func (ip *interpolation) expand(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var b strings.Builder
+
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1] + "${")
+			s = s[i+2:]
+			continue
+		}
+
+		b.WriteString(s[:i])
+		s = s[i+2:]
+
+		end := strings.Index(s, "}")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference ${%s", s)
+		}
+
+		value, err := ip.lookup(s[:end])
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(value)
+		s = s[end+1:]
+	}
+}
+
+// lookup returns the value of the reference `ref`, the text between "${"
+// and "}".
+func (ip *interpolation) lookup(ref string) (string, error) {
+	name, fallback, hasFallback := strings.Cut(ref, ":-")
+	if name == "" {
+		return "", fmt.Errorf("empty reference ${%s}", ref)
+	}
+
+	var value string
+
+	if key, ok := strings.CutPrefix(name, "."); ok {
+		f, ok := ip.keys[strings.ToLower(key)]
+		if !ok {
+			return "", fmt.Errorf("${%s}: %w", ref, ErrUnknownKey)
+		}
+
+		var err error
+		value, err = ip.resolve(f)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		var ok bool
+		value, ok = os.LookupEnv(name)
+		if !ok && (!hasFallback || strings.Contains(name, ".")) {
+			if _, isKey := ip.keys[strings.ToLower(name)]; isKey {
+				return "", fmt.Errorf("${%s}: variable not set; use ${.%s} to refer to the config key", ref, ref)
+			}
+		}
+
+		if !ok && !hasFallback {
+			return "", fmt.Errorf("${%s}: variable not set", ref)
+		}
+	}
+
+	if value == "" && hasFallback {
+		return fallback, nil
+	}
+
+	return value, nil
+}
+
+// interpText formats the value of a leaf field, revealing secrets.
+func interpText(v reflect.Value) string {
+	if sv, ok := v.Interface().(secretValue); ok {
+		return fmt.Sprint(sv.secret())
+	}
+
+	if tm, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, err := tm.MarshalText()
+		if err == nil {
+			return string(b)
+		}
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+// setInterp stores the expanded string `s` into `v`.
+func setInterp(v reflect.Value, s string) error {
+	if v.Kind() == reflect.String {
+		v.SetString(s)
+		return nil
+	}
+
+	return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+}
+
+func indexOf(s []string, x string) int {
+	for i, e := range s {
+		if e == x {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,186 @@
+package configo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// Option configures Load.
+type Option func(*loadOptions)
+
+type loadOptions struct {
+	files      []string
+	profile    string
+	prefix     string
+	env        bool
+	strict     bool
+	interp     bool
+	validate   bool
+	migrations *Migrations
+	sources    []Configo
+	logger     Logger
+	prov       Provenance
+}
+
+// WithFile reads the TOML file `path`. Files given by several WithFile
+// options are applied in order, so later files override earlier ones: every
+// key set in a file is applied, even to a zero value such as false, 0 or "".
+func WithFile(path string) Option {
+	return func(o *loadOptions) { o.files = append(o.files, path) }
+}
+
+// WithProfile applies, after each file such as "config.toml", the file
+// "config.<profile>.toml" next to it if it exists, e.g. to override
+// settings in production.
+func WithProfile(profile string) Option {
+	return func(o *loadOptions) { o.profile = profile }
+}
+
+// WithEnvPrefix reads environment variables with `prefix` prepended to the
+// names in "env" tags. See EnvConfigo.Prefix.
+func WithEnvPrefix(prefix string) Option {
+	return func(o *loadOptions) { o.prefix = prefix }
+}
+
+// WithoutEnv leaves environment variables out.
+func WithoutEnv() Option {
+	return func(o *loadOptions) { o.env = false }
+}
+
+// WithStrict rejects keys in files, and prefixed environment variables,
+// that match no field. Environment variables are only checked given
+// WithEnvPrefix. See TomlConfigo.Strict and EnvConfigo.Strict.
+func WithStrict() Option {
+	return func(o *loadOptions) { o.strict = true }
+}
+
+// WithMigrations migrates every file read with `ms` before decoding it. See
+// TomlConfigo.Migrations.
+func WithMigrations(ms *Migrations) Option {
+	return func(o *loadOptions) { o.migrations = ms }
+}
+
+// WithInterpolation expands the `${...}` references in the string values
+// read from files, once every source has been applied. See
+// InterpolateConfigo.
+func WithInterpolation() Option {
+	return func(o *loadOptions) { o.interp = true }
+}
+
+// WithoutValidation skips checking the rules in "validate" tags. The
+// AfterLoad and Validate hooks of the config still run, since they may
+// complete it; see ConfigoChain.Load.
+func WithoutValidation() Option {
+	return func(o *loadOptions) { o.validate = false }
+}
+
+// WithSource applies `c` after files and environment variables, e.g. a
+// ResolveConfigo.
+func WithSource(c Configo) Option {
+	return func(o *loadOptions) { o.sources = append(o.sources, c) }
+}
+
+// WithLogger sets where warnings, such as those about deprecated settings,
+// are logged. See ConfigoChain.Logger.
+func WithLogger(l Logger) Option {
+	return func(o *loadOptions) { o.logger = l }
+}
+
+// WithProvenance records into `p` where the value of every field came
+// from. See ConfigoChain.TrackProvenance.
+func WithProvenance(p Provenance) Option {
+	return func(o *loadOptions) { o.prov = p }
+}
+
+// Load returns a new config of struct type T, loaded from the following
+// sources in order: "default" tags, the files given by WithFile and their
+// profile overlays, environment variables and the sources given by
+// WithSource. It is then checked against its "validate" tags. See
+// UnmarshalFile.
+//
+// The returned error wraps ErrInvalidTarget if T is not a struct type, and
+// is a *LoadErrors listing every failure otherwise.
+func Load[T any](opts ...Option) (*T, error) {
+	o := &loadOptions{env: true, validate: true}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	v := new(T)
+
+	if t := reflect.TypeOf(v).Elem(); t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("configo: cannot load a config of type %s: %w", t, ErrInvalidTarget)
+	}
+
+	chain := NewConfigoChain(o.configos()...)
+
+	if o.logger != nil {
+		chain.Logger(o.logger)
+	}
+
+	if o.prov != nil {
+		chain.TrackProvenance(o.prov)
+	}
+
+	err := chain.Load(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func (o *loadOptions) configos() []Configo {
+	configos := []Configo{NewDefaultsConfigo()}
+
+	for _, f := range o.files {
+		configos = append(configos, o.toml(f))
+
+		if o.profile != "" {
+			overlay := profileFile(f, o.profile)
+			if _, err := os.Stat(overlay); err == nil {
+				configos = append(configos, o.toml(overlay))
+			}
+		}
+	}
+
+	if o.env {
+		ec := NewEnvConfigo().Prefix(o.prefix)
+		if o.strict && o.prefix != "" {
+			ec.Strict()
+		}
+
+		configos = append(configos, ec)
+	}
+
+	configos = append(configos, o.sources...)
+
+	if o.interp {
+		configos = append(configos, NewInterpolateConfigo())
+	}
+
+	if o.validate {
+		configos = append(configos, NewValidateConfigo())
+	}
+
+	return configos
+}
+
+func (o *loadOptions) toml(f string) *TomlConfigo {
+	tc := NewTomlConfigo(f).Migrations(o.migrations)
+	if o.strict {
+		tc.Strict()
+	}
+
+	return tc
+}
+
+// profileFile returns the overlay of `file` for `profile`, e.g.
+// "config.prod.toml" for "config.toml".
+func profileFile(file, profile string) string {
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "." + profile + ext
+}
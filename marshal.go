@@ -0,0 +1,359 @@
+package configo
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// MarshalOption configures MarshalTOML and WriteFile.
+type MarshalOption func(*marshaler)
+
+// OmitDefaults leaves out fields whose value equals their "default" tag.
+// Fields without the tag are always written.
+func OmitDefaults() MarshalOption {
+	return func(m *marshaler) { m.omitDefaults = true }
+}
+
+// AnnotateSources appends a comment to every key naming where its value
+// came from, as recorded in `p` by ConfigoChain.TrackProvenance.
+func AnnotateSources(p Provenance) MarshalOption {
+	return func(m *marshaler) { m.prov = p }
+}
+
+// RevealSecrets writes the actual value of secret fields, which are masked
+// by default. See Secret.
+func RevealSecrets() MarshalOption {
+	return func(m *marshaler) { m.reveal = true }
+}
+
+// MarshalTOML encodes the config `v`, a struct or a pointer to one, as TOML.
+// Keys are named after the `toml` tag of each field, or the field name if it
+// has none, so the output can be read back by FromTOML. Nil pointers and
+// fields tagged `toml:"-"` are left out. The values of secret fields are
+// masked unless RevealSecrets is given.
+func MarshalTOML(v interface{}, opts ...MarshalOption) ([]byte, error) {
+	m := &marshaler{notes: map[string]string{}}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	rv := indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("configo: cannot marshal %T, want a struct", v)
+	}
+
+	doc, err := m.table(rv, "", "", false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	enc := toml.NewEncoder(&buf)
+	enc.Indent = ""
+
+	err = enc.Encode(doc.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("configo: %w", err)
+	}
+
+	return m.annotate(buf.Bytes()), nil
+}
+
+// WriteFile writes the config `v` to the file `path` in TOML format. See
+// MarshalTOML. An existing file keeps its mode and a new one is created with
+// mode 0644, but with RevealSecrets the file is only readable by its owner.
+// The file is replaced at once, so it is never left partly written.
+func WriteFile(path string, v interface{}, opts ...MarshalOption) error {
+	b, err := MarshalTOML(v, opts...)
+	if err != nil {
+		return err
+	}
+
+	var m marshaler
+	for _, opt := range opts {
+		opt(&m)
+	}
+
+	perm := os.FileMode(0o644)
+	if fi, err := os.Stat(path); err == nil {
+		perm = fi.Mode().Perm()
+	}
+
+	if m.reveal {
+		perm &^= 0o077
+	}
+
+	return replaceFile(path, b, perm)
+}
+
+// marshaler builds the document the TOML encoder writes: a struct type made
+// for each table, so fields keep their order, with secrets masked and
+// defaults left out as asked.
+type marshaler struct {
+	omitDefaults bool
+	reveal       bool
+	prov         Provenance
+	// notes maps the normalized dotted keys to annotate to their comment.
+	notes map[string]string
+}
+
+// tomlField is a field, or map entry, to be written as part of a table.
+type tomlField struct {
+	key    string
+	path   string
+	value  reflect.Value
+	secret bool
+}
+
+// table returns the document for the fields of struct or map `v`, found at
+// the normalized dotted key `key`. Values inside arrays of tables are not
+// annotated, since their keys repeat.
+func (m *marshaler) table(v reflect.Value, path, key string, secret, inArray bool) (reflect.Value, error) {
+	fields, err := m.fields(v, path, secret)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	values := make([]reflect.Value, len(fields))
+	for i, f := range fields {
+		values[i], err = m.value(f, joinPath(key, strings.ToLower(f.key)), inArray)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+	}
+
+	if v.Kind() == reflect.Map {
+		doc := make(map[string]interface{}, len(fields))
+		for i, f := range fields {
+			doc[f.key] = values[i].Interface()
+		}
+
+		return reflect.ValueOf(doc), nil
+	}
+
+	sfs := make([]reflect.StructField, len(fields))
+	for i, f := range fields {
+		sfs[i] = reflect.StructField{
+			Name: fmt.Sprintf("F%d", i),
+			Type: values[i].Type(),
+			Tag:  reflect.StructTag("toml:" + strconv.Quote(f.key)),
+		}
+	}
+
+	doc := reflect.New(reflect.StructOf(sfs)).Elem()
+	for i := range fields {
+		doc.Field(i).Set(values[i])
+	}
+
+	return doc, nil
+}
+
+// value returns the document for field `f`, found at the normalized dotted
+// key `key`.
+func (m *marshaler) value(f tomlField, key string, inArray bool) (reflect.Value, error) {
+	switch {
+	case isTable(f.value):
+		return m.table(f.value, f.path, key, f.secret, inArray)
+	case isTableArray(f.value):
+		tables := make([]interface{}, f.value.Len())
+		for i := range tables {
+			t, err := m.table(indirect(f.value.Index(i)), fmt.Sprintf("%s[%d]", f.path, i), key, f.secret, true)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+
+			tables[i] = t.Interface()
+		}
+
+		return reflect.ValueOf(tables), nil
+	}
+
+	if o, ok := m.prov[f.path]; ok && !inArray {
+		m.notes[key] = o.String()
+	}
+
+	if f.secret && !m.reveal {
+		return reflect.ValueOf(secretMask), nil
+	}
+
+	if sv, ok := f.value.Interface().(secretValue); ok && m.reveal {
+		return reflect.ValueOf(sv.secret()), nil
+	}
+
+	return emptySlice(f.value), nil
+}
+
+// emptySlice returns an empty slice for the nil slice `v`, which the encoder
+// would leave out rather than write as [], and `v` otherwise.
+func emptySlice(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Slice && v.IsNil() {
+		return reflect.MakeSlice(v.Type(), 0, 0)
+	}
+
+	return v
+}
+
+// annotate appends the notes as comments to the lines of the keys they
+// belong to in the encoded document `b`.
+func (m *marshaler) annotate(b []byte) []byte {
+	if len(m.notes) == 0 {
+		return b
+	}
+
+	lines := strings.Split(string(b), "\n")
+	for key, n := range tomlKeyLines(b) {
+		if note, ok := m.notes[key]; ok && n <= len(lines) {
+			lines[n-1] += " # " + note
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// fields lists the entries of struct or map `v` that should be written.
+// Entries inherit `secret` from the table holding them.
+func (m *marshaler) fields(v reflect.Value, path string, secret bool) ([]tomlField, error) {
+	var fields []tomlField
+
+	if v.Kind() == reflect.Map {
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("configo: %s: map keys must be strings", path)
+		}
+
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+		for _, k := range keys {
+			val := indirect(v.MapIndex(k))
+			if val.IsValid() {
+				fields = append(fields, tomlField{key: k.String(), path: fmt.Sprintf("%s[%s]", path, k.String()), value: val, secret: secret})
+			}
+		}
+
+		return fields, nil
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		typ := v.Type().Field(i)
+		if typ.PkgPath != "" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(typ.Tag.Get("toml"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = typ.Name
+		}
+
+		val := indirect(v.Field(i))
+		if !val.IsValid() {
+			continue
+		}
+
+		if strings.Contains(opts, "omitempty") && val.IsZero() {
+			continue
+		}
+
+		if m.omitDefaults && isDefault(val, typ.Tag.Get("default")) {
+			continue
+		}
+
+		fields = append(fields, tomlField{key: name, path: joinPath(path, typ.Name), value: val, secret: secret || isSecret(typ)})
+	}
+
+	return fields, nil
+}
+
+// isDefault reports whether `v` equals the value the "default" tag `tag`
+// gives it. Fields without the tag have no default, so they are always
+// written, even when zero.
+func isDefault(v reflect.Value, tag string) bool {
+	if tag == "" {
+		return false
+	}
+
+	d := reflect.New(v.Type()).Elem()
+	if set(&d, tag) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(d.Interface(), v.Interface())
+}
+
+var textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// isTable reports whether `v` is written as a TOML table.
+func isTable(v reflect.Value) bool {
+	if v.Type().Implements(textMarshaler) {
+		return false
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return hasExportedFields(v.Type())
+	case reflect.Map:
+		return true
+	}
+
+	return false
+}
+
+// isTableArray reports whether `v` is written as an array of TOML tables.
+func isTableArray(v reflect.Value) bool {
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return false
+	}
+
+	if v.Len() == 0 {
+		return false
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		e := indirect(v.Index(i))
+		if !e.IsValid() || !isTable(e) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// tomlKey quotes the key `k` if it is not a bare key.
+func tomlKey(k string) string {
+	return toml.Key{k}.String()
+}
+
+// tomlValue formats a non-table value as the TOML encoder writes it.
+func tomlValue(v reflect.Value) (string, error) {
+	var buf bytes.Buffer
+
+	err := toml.NewEncoder(&buf).Encode(map[string]interface{}{"v": emptySlice(v).Interface()})
+	if err != nil {
+		return "", err
+	}
+
+	s, ok := strings.CutPrefix(buf.String(), "v = ")
+	if !ok {
+		return "", fmt.Errorf("%s is not a TOML value", v.Type())
+	}
+
+	return strings.TrimSuffix(s, "\n"), nil
+}
+
+// tomlString quotes `s` as a TOML basic string.
+func tomlString(s string) string {
+	q, _ := tomlValue(reflect.ValueOf(s))
+	return q
+}
@@ -0,0 +1,153 @@
+package configo
+
+import (
+	"reflect"
+	"strings"
+)
+
+// fieldInfo is the tag metadata of a config field, as read by the loaders.
+// It drives the helpers generating samples, documentation and schemas.
+type fieldInfo struct {
+	// Name is the Go field name and Path the dotted path of Go field names.
+	Name string
+	Path string
+	// Key is the TOML key of the field and KeyPath the dotted path of keys.
+	Key     string
+	KeyPath string
+
+	Env string
+	// Aliases are the former TOML keys of the field, dotted from the root,
+	// and EnvAliases its former environment variables.
+	Aliases    []string
+	EnvAliases []string
+	Default    string
+	Desc       string
+	Validate   string
+	Secret     bool
+	// Derived is set if Default is derived from other fields.
+	Derived bool
+
+	// Type is the type of the field with pointers removed.
+	Type reflect.Type
+	// Fields describes the fields of a nested struct, or of the elements of
+	// a slice of structs.
+	Fields []fieldInfo
+}
+
+// Required reports whether the field has a "required" validate rule.
+func (fi fieldInfo) Required() bool {
+	for _, r := range parseRules(fi.Validate) {
+		if r.Name == "required" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsTable reports whether the field is a nested struct.
+func (fi fieldInfo) IsTable() bool {
+	return fi.Type.Kind() == reflect.Struct && fi.Fields != nil
+}
+
+// IsTableArray reports whether the field is a slice of structs.
+func (fi fieldInfo) IsTableArray() bool {
+	return (fi.Type.Kind() == reflect.Slice || fi.Type.Kind() == reflect.Array) && fi.Fields != nil
+}
+
+// describe returns the metadata of every exported field of struct type `t`.
+func describe(t reflect.Type) []fieldInfo {
+	return describeFields(t, "", "", map[reflect.Type]bool{})
+}
+
+func describeFields(t reflect.Type, path, keyPath string, seen map[reflect.Type]bool) []fieldInfo {
+	t = derefType(t)
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+
+	seen[t] = true
+	defer delete(seen, t)
+
+	var fields []fieldInfo
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		key, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+		if key == "-" {
+			continue
+		}
+
+		if key == "" {
+			key = f.Name
+		}
+
+		aliases, envAliases, _ := splitAliases(f.Tag.Get("alias"))
+
+		fi := fieldInfo{
+			Name:       f.Name,
+			Path:       joinPath(path, f.Name),
+			Key:        key,
+			KeyPath:    joinPath(keyPath, key),
+			Env:        f.Tag.Get("env"),
+			Aliases:    aliases,
+			EnvAliases: envAliases,
+			Default:    f.Tag.Get("default"),
+			Desc:       f.Tag.Get("desc"),
+			Validate:   f.Tag.Get("validate"),
+			Secret:     isSecret(f),
+			Derived:    isDerived(f.Tag.Get("default")),
+			Type:       derefType(f.Type),
+		}
+
+		switch {
+		case isStructType(fi.Type):
+			fi.Fields = describeFields(fi.Type, fi.Path, fi.KeyPath, seen)
+			if fi.Fields == nil {
+				fi.Fields = []fieldInfo{}
+			}
+		case (fi.Type.Kind() == reflect.Slice || fi.Type.Kind() == reflect.Array) && isStructType(derefType(fi.Type.Elem())):
+			fi.Fields = describeFields(fi.Type.Elem(), fi.Path+"[]", fi.KeyPath, seen)
+			if fi.Fields == nil {
+				fi.Fields = []fieldInfo{}
+			}
+		}
+
+		fields = append(fields, fi)
+	}
+
+	return fields
+}
+
+// valueType returns the type of the value held by a field of type `t`, with
+// pointers and Secret removed.
+func valueType(t reflect.Type) reflect.Type {
+	t = derefType(t)
+	if t.Implements(secretValueType) {
+		return derefType(t.Field(0).Type)
+	}
+
+	return t
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// isStructType reports whether `t` is a struct walked field by field, as
+// opposed to an opaque value such as time.Time.
+func isStructType(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t.Implements(textMarshaler) || reflect.PointerTo(t).Implements(textMarshaler) {
+		return false
+	}
+
+	return hasExportedFields(t)
+}
@@ -0,0 +1,140 @@
+package configo
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+)
+
+// VersionKey is the top-level key holding the layout version of a config
+// file, e.g. `version = 3`.
+const VersionKey = "version"
+
+// MigrationFunc rewrites a decoded config document in place from one layout
+// version to the next.
+type MigrationFunc func(doc map[string]interface{}) error
+
+type migration struct {
+	to int
+	fn MigrationFunc
+}
+
+// Migrations rewrites config files written for older layouts of a config
+// struct. It only applies to the files of the TomlConfigo it is given to,
+// see TomlConfigo.Migrations and WithMigrations. A nil *Migrations has no
+// migrations.
+type Migrations struct {
+	m map[int]migration
+}
+
+func NewMigrations() *Migrations { return &Migrations{m: map[int]migration{}} }
+
+// Add makes `fn` rewrite documents of layout version `from` to version
+// `to`. A file is migrated before being decoded by applying the migrations
+// from its version in turn until none is left, and setting VersionKey to the
+// last version reached. Files without VersionKey are version 0.
+//
+// Add panics if `to` is not greater than `from` or a migration from `from`
+// was already added.
+func (ms *Migrations) Add(from, to int, fn MigrationFunc) *Migrations {
+	if to <= from {
+		panic(fmt.Sprintf("configo: migration from %d to %d does not go forward", from, to))
+	}
+
+	if _, ok := ms.m[from]; ok {
+		panic(fmt.Sprintf("configo: migration from %d added twice", from))
+	}
+
+	ms.m[from] = migration{to: to, fn: fn}
+	return ms
+}
+
+// Migrate applies the migrations to the decoded document `doc` and returns
+// the versions it was migrated from and to, equal if there was nothing to
+// do.
+func (ms *Migrations) Migrate(doc map[string]interface{}) (from, to int, err error) {
+	switch v := doc[VersionKey].(type) {
+	case nil:
+	case int64:
+		from = int(v)
+	default:
+		return 0, 0, fmt.Errorf("%s must be an integer, not %T", VersionKey, v)
+	}
+
+	to = from
+
+	for ms != nil {
+		m, ok := ms.m[to]
+		if !ok {
+			break
+		}
+
+		err = m.fn(doc)
+		if err != nil {
+			return from, to, fmt.Errorf("migrating from version %d to %d: %w", to, m.to, err)
+		}
+
+		to = m.to
+	}
+
+	if to != from {
+		doc[VersionKey] = int64(to)
+	}
+
+	return from, to, nil
+}
+
+// toml migrates the TOML document `b`, returning it re-encoded if any
+// migration applied and unchanged otherwise, along with the versions it was
+// migrated from and to.
+func (ms *Migrations) toml(b []byte) (out []byte, from, to int, err error) {
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(b), &doc); err != nil {
+		return nil, 0, 0, err
+	}
+
+	from, to, err = ms.Migrate(doc)
+	if err != nil || from == to {
+		return b, from, to, err
+	}
+
+	var buf bytes.Buffer
+
+	enc := toml.NewEncoder(&buf)
+	enc.Indent = ""
+
+	err = enc.Encode(doc)
+	if err != nil {
+		return nil, from, to, err
+	}
+
+	return buf.Bytes(), from, to, nil
+}
+
+// MigrateFile migrates the config file `path` to the latest layout version
+// and returns the versions it was migrated from and to. The file is only
+// rewritten if a migration applied. It is then re-encoded from the migrated
+// document, so its comments and formatting are lost, and replaced at once,
+// so it is never left partly written.
+//
+// Files holding encrypted values are not rewritten and ErrEncryptedMigration
+// is returned; they are still migrated as they are loaded.
+func (ms *Migrations) MigrateFile(path string) (from, to int, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	out, from, to, err := ms.toml(b)
+	if err != nil || from == to {
+		return from, to, err
+	}
+
+	if hasEncrypted(b) {
+		return from, to, ErrEncryptedMigration
+	}
+
+	return from, to, writeFileAtomic(path, out)
+}
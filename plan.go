@@ -0,0 +1,117 @@
+package configo
+
+import (
+	"reflect"
+	"sync"
+)
+
+// typePlan holds what the loaders need to know about the fields of a struct
+// type, so tags are parsed once per type rather than on every load.
+type typePlan struct {
+	// fields lists the exported fields, in order.
+	fields []fieldPlan
+}
+
+// fieldPlan is the parsed metadata of a single field.
+type fieldPlan struct {
+	index int
+	name  string
+	// tomlKey is the lowercased key the field is decoded from.
+	tomlKey string
+
+	env         string
+	tomlAliases []string
+	envAliases  []string
+	// alias is the "alias" tag, and aliasErr the error of its invalid
+	// aliases if any.
+	alias      string
+	aliasErr   error
+	deprecated string
+	def        string
+	// defErr is set if def refers to a field without the leading dot.
+	defErr error
+	// derived is set if def is derived from other fields.
+	derived bool
+	secret  bool
+	rules   []rule
+	// strings tells how the field is set from its "env" and "default"
+	// tags.
+	strings stringKind
+	// conv sets the field from a string; nil unless strings is fromString.
+	conv converter
+
+	// structType is set if the field is a struct, or a pointer to one, whose
+	// fields are walked.
+	structType bool
+}
+
+// plans caches the *typePlan of every struct type loaded.
+var plans sync.Map
+
+// planFor returns the plan of struct type `t`.
+func planFor(t reflect.Type) *typePlan {
+	if p, ok := plans.Load(t); ok {
+		return p.(*typePlan)
+	}
+
+	p, _ := plans.LoadOrStore(t, newPlan(t))
+	return p.(*typePlan)
+}
+
+func newPlan(t reflect.Type) *typePlan {
+	p := &typePlan{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		alias := f.Tag.Get("alias")
+		tomlAliases, envAliases, aliasErr := splitAliases(alias)
+		def := f.Tag.Get("default")
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		strings := stringKindOf(f.Type)
+
+		var conv converter
+		if strings == fromString {
+			conv = converterFor(f.Type)
+		}
+
+		p.fields = append(p.fields, fieldPlan{
+			index:       i,
+			name:        f.Name,
+			tomlKey:     tomlName(f),
+			env:         f.Tag.Get("env"),
+			tomlAliases: tomlAliases,
+			envAliases:  envAliases,
+			alias:       alias,
+			aliasErr:    aliasErr,
+			deprecated:  f.Tag.Get("deprecated"),
+			def:         def,
+			defErr:      bareRefError(t, def),
+			derived:     def != "" && isDerived(def),
+			secret:      isSecret(f),
+			rules:       parseRules(f.Tag.Get("validate")),
+			strings:     strings,
+			conv:        conv,
+			structType:  isStructType(ft),
+		})
+	}
+
+	return p
+}
+
+// nested reports whether the value `v` of the field is walked, as isNested.
+func (fp *fieldPlan) nested(v reflect.Value) bool {
+	if !fp.structType {
+		return false
+	}
+
+	return v.Kind() == reflect.Struct || !v.IsNil()
+}
@@ -0,0 +1,191 @@
+package configo
+
+import (
+	"os"
+	"reflect"
+)
+
+// The walkers below are how setDefaults, setEnv and setToml read the tags
+// of every field on every load before plans. They are kept to benchmark
+// the plans against.
+
+func legacySetDefaults(v *reflect.Value, path string, p Provenance, errs *LoadErrors) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if isZero(*v) {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		nv := v.Elem()
+
+		legacySetDefaults(&nv, path, p, errs)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			val := v.Field(i)
+			typ := v.Type().Field(i)
+			fpath := joinPath(path, typ.Name)
+
+			if typ.PkgPath != "" {
+				continue
+			}
+
+			if isNested(val) {
+				legacySetDefaults(&val, fpath, p, errs)
+				continue
+			}
+
+			tag := typ.Tag.Get("default")
+			strings := stringKindOf(typ.Type)
+
+			if tag != "" && strings == noString {
+				errs.add(newFieldError(fpath, "default", tag, isSecret(typ), unsupported(val.Type())))
+				continue
+			}
+
+			if isZero(val) {
+				if val.Kind() == reflect.Ptr {
+					val.Set(reflect.New(val.Type().Elem()))
+				}
+
+				if tag != "" && !isDerived(tag) && strings == fromString {
+					err := set(&val, tag)
+					if err != nil {
+						errs.add(newFieldError(fpath, "default", tag, isSecret(typ), err))
+						continue
+					}
+
+					p.record(fpath, Origin{Source: "default"})
+				}
+			}
+		}
+	}
+}
+
+func legacySetEnv(v *reflect.Value, path string, ep *envPass) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		nv := v.Elem()
+
+		legacySetEnv(&nv, path, ep)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			val := v.Field(i)
+			typ := v.Type().Field(i)
+			fpath := joinPath(path, typ.Name)
+
+			if typ.PkgPath != "" {
+				continue
+			}
+
+			if isNested(val) {
+				legacySetEnv(&val, fpath, ep)
+				continue
+			}
+
+			name, getenv := legacyLookup(ep, typ)
+			if getenv == "" {
+				continue
+			}
+
+			if stringKindOf(typ.Type) != fromString {
+				continue
+			}
+
+			err := set(&val, getenv)
+			if err != nil {
+				ep.errs.add(newFieldError(fpath, "env:"+name, getenv, isSecret(typ), err))
+				continue
+			}
+
+			ep.prov.record(fpath, Origin{Source: "env", Var: name})
+		}
+	}
+}
+
+// legacyLookup is envPass.lookup, parsing the tags of field `f`.
+func legacyLookup(ep *envPass, f reflect.StructField) (name, value string) {
+	deprecated := f.Tag.Get("deprecated")
+
+	if env := f.Tag.Get("env"); env != "" {
+		name = ep.prefix + env
+		ep.seen[name] = true
+		value = os.Getenv(name)
+
+		if value != "" && deprecated != "" {
+			warnDeprecated(ep.logger, "environment variable "+name, "", deprecated)
+		}
+	}
+
+	_, aliases, _ := splitAliases(f.Tag.Get("alias"))
+
+	for _, alias := range aliases {
+		aname := ep.prefix + alias
+		ep.seen[aname] = true
+
+		avalue := os.Getenv(aname)
+		if avalue == "" {
+			continue
+		}
+
+		if value != "" {
+			logf(ep.logger, "configo: environment variable %s is ignored since %s is set", aname, name)
+			continue
+		}
+
+		warnDeprecated(ep.logger, "environment variable "+aname, name, deprecated)
+		name, value = aname, avalue
+	}
+
+	return name, value
+}
+
+func legacySetToml(dst *reflect.Value, src reflect.Value, path, key string, defined map[string]bool, o *tomlOrigins) error {
+	var err error
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return nil
+		}
+
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+
+		dnv := dst.Elem()
+		snv := src.Elem()
+
+		err = legacySetToml(&dnv, snv, path, key, defined, o)
+		if err != nil {
+			return err
+		}
+	case reflect.Struct:
+		for i := 0; i < dst.NumField(); i++ {
+			dval := dst.Field(i)
+			sval := src.Field(i)
+			typ := dst.Type().Field(i)
+			fpath := joinPath(path, typ.Name)
+			fkey := joinPath(key, tomlName(typ))
+
+			if typ.PkgPath != "" {
+				continue
+			}
+
+			if isNested(dval) {
+				err = legacySetToml(&dval, sval, fpath, fkey, defined, o)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if defined[fkey] {
+				dval.Set(sval)
+				o.record(fpath, fkey)
+			}
+		}
+	}
+
+	return nil
+}
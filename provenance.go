@@ -0,0 +1,83 @@
+package configo
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Origin describes where the value of a single field came from.
+type Origin struct {
+	// Source is the kind of source that set the value: "caller" for values
+	// already present in the struct, "default", "toml" or "env".
+	Source string
+	// File is the file the value was read from, if any.
+	File string
+	// Line is the line in File the value was defined on, 0 if unknown.
+	Line int
+	// Var is the environment variable the value was read from, if any.
+	Var string
+}
+
+func (o Origin) String() string {
+	switch {
+	case o.File != "" && o.Line > 0:
+		return fmt.Sprintf("%s %s:%d", o.Source, o.File, o.Line)
+	case o.File != "":
+		return fmt.Sprintf("%s %s", o.Source, o.File)
+	case o.Var != "":
+		return fmt.Sprintf("%s %s", o.Source, o.Var)
+	}
+
+	return o.Source
+}
+
+// Provenance maps a field path such as "Mysql.Dsn" to the origin of the
+// field's value. The last source to set a field wins, mirroring the order
+// sources are applied in.
+type Provenance map[string]Origin
+
+func (p Provenance) record(path string, o Origin) {
+	if p == nil {
+		return
+	}
+
+	p[path] = o
+}
+
+// tracker is implemented by sources that can report the origin of every
+// value they set.
+type tracker interface {
+	track(v interface{}, p Provenance) error
+}
+
+// recordCaller attributes every non-zero field of `v` to the caller.
+func recordCaller(v reflect.Value, path string, p Provenance) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+
+		recordCaller(v.Elem(), path, p)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			val := v.Field(i)
+			typ := v.Type().Field(i)
+
+			if typ.PkgPath != "" {
+				continue
+			}
+
+			fpath := joinPath(path, typ.Name)
+
+			if isNested(val) {
+				recordCaller(val, fpath, p)
+				continue
+			}
+
+			if !isZero(val) {
+				p.record(fpath, Origin{Source: "caller"})
+			}
+		}
+	}
+}
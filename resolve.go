@@ -0,0 +1,222 @@
+package configo
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// SecretResolver returns the secret a reference such as "env://DB_PASS"
+// points to. It is given the reference with its "scheme://" prefix removed.
+type SecretResolver interface {
+	Resolve(ref string) (string, error)
+}
+
+// SecretResolverFunc adapts a function to a SecretResolver.
+type SecretResolverFunc func(ref string) (string, error)
+
+func (f SecretResolverFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+// FileResolver reads the secret from the file named by the reference, e.g.
+// "file:///run/secrets/db". Trailing newlines are removed.
+type FileResolver struct{}
+
+func (FileResolver) Resolve(ref string) (string, error) {
+	b, err := os.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// EnvResolver reads the secret from the environment variable named by the
+// reference, e.g. "env://DB_PASS".
+type EnvResolver struct{}
+
+func (EnvResolver) Resolve(ref string) (string, error) {
+	s, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("variable %s not set", ref)
+	}
+
+	return s, nil
+}
+
+// ExecResolver runs the command given by the reference, split on spaces
+// without a shell, and returns its output with trailing newlines removed,
+// e.g. "exec://pass show db". Since whoever writes a config file could then
+// run commands, it is not registered by default.
+type ExecResolver struct{}
+
+func (ExecResolver) Resolve(ref string) (string, error) {
+	args := strings.Fields(ref)
+	if len(args) == 0 {
+		return "", fmt.Errorf("empty command")
+	}
+
+	out, err := exec.Command(args[0], args[1:]...).Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// MapResolver resolves references from a map, e.g. to test configs that
+// refer to secrets without a live secret store.
+type MapResolver map[string]string
+
+func (m MapResolver) Resolve(ref string) (string, error) {
+	s, ok := m[ref]
+	if !ok {
+		return "", fmt.Errorf("no secret %s", ref)
+	}
+
+	return s, nil
+}
+
+var resolvers = struct {
+	sync.RWMutex
+	m map[string]SecretResolver
+}{m: map[string]SecretResolver{
+	"file": FileResolver{},
+	"env":  EnvResolver{},
+}}
+
+// RegisterSecretResolver makes `r` resolve the references with scheme
+// `scheme`, e.g. "vault" for "vault://db/password", replacing any resolver
+// registered for it. FileResolver and EnvResolver are registered for "file"
+// and "env" by default. A nil `r` unregisters the scheme. Schemes are
+// case-insensitive.
+func RegisterSecretResolver(scheme string, r SecretResolver) {
+	resolvers.Lock()
+	defer resolvers.Unlock()
+
+	scheme = strings.ToLower(scheme)
+
+	if r == nil {
+		delete(resolvers.m, scheme)
+		return
+	}
+
+	resolvers.m[scheme] = r
+}
+
+// ResolveConfigo replaces secret references in the secret fields of the
+// merged config, those of type Secret[T] or with a `secret:"true"` tag, by
+// the secrets they point to. It is meant to follow every other source of a
+// ConfigoChain, and to precede ValidateConfigo.
+//
+// A reference is a value of the form "scheme://ref" whose scheme has a
+// resolver, registered with RegisterSecretResolver or With. Other values,
+// including URLs of schemes without a resolver, are left as they are, as are
+// fields that are not secret, so a setting such as "file:///var/lib/app"
+// keeps its value.
+type ResolveConfigo struct {
+	resolvers map[string]SecretResolver
+}
+
+func NewResolveConfigo() *ResolveConfigo { return &ResolveConfigo{} }
+
+// With makes this ResolveConfigo use `r` for the references with scheme
+// `scheme`, over the resolver registered for it.
+func (rc *ResolveConfigo) With(scheme string, r SecretResolver) *ResolveConfigo {
+	if rc.resolvers == nil {
+		rc.resolvers = map[string]SecretResolver{}
+	}
+
+	rc.resolvers[strings.ToLower(scheme)] = r
+	return rc
+}
+
+func (rc *ResolveConfigo) merged() {}
+
+// Load resolves the references in the secret fields of pointer `v`. The
+// returned error is a *LoadErrors holding a *FieldError for every reference
+// that cannot be resolved.
+func (rc *ResolveConfigo) Load(v interface{}) error {
+	resolvers.RLock()
+	m := make(map[string]SecretResolver, len(resolvers.m)+len(rc.resolvers))
+	for scheme, r := range resolvers.m {
+		m[scheme] = r
+	}
+	resolvers.RUnlock()
+
+	for scheme, r := range rc.resolvers {
+		m[scheme] = r
+	}
+
+	rv, err := target(v)
+	if err != nil {
+		return err
+	}
+
+	var errs LoadErrors
+	resolveSecrets(rv, "", m, &errs)
+	return errs.err()
+}
+
+var secretRef = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*)://(.*)$`)
+
+func resolveSecrets(v reflect.Value, path string, m map[string]SecretResolver, errs *LoadErrors) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+
+		resolveSecrets(v.Elem(), path, m, errs)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			val := v.Field(i)
+			typ := v.Type().Field(i)
+			fpath := joinPath(path, typ.Name)
+
+			if typ.PkgPath != "" {
+				continue
+			}
+
+			if isNested(val) {
+				resolveSecrets(val, fpath, m, errs)
+				continue
+			}
+
+			if !isSecret(typ) {
+				continue
+			}
+
+			val = indirect(val)
+			if !val.IsValid() || !isInterpString(val) {
+				continue
+			}
+
+			s := interpText(val)
+
+			match := secretRef.FindStringSubmatch(s)
+			if match == nil {
+				continue
+			}
+
+			r, ok := m[strings.ToLower(match[1])]
+			if !ok {
+				continue
+			}
+
+			secret, err := r.Resolve(match[2])
+			if err == nil {
+				err = setInterp(val, secret)
+			}
+
+			if err != nil {
+				errs.add(newFieldError(fpath, "resolve:"+match[1], s, isSecret(typ), err))
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package configo
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SampleFormat selects the file format written by GenerateSample.
+type SampleFormat int
+
+const (
+	SampleTOML SampleFormat = iota
+	SampleYAML
+)
+
+// GenerateSample returns a commented starter config file for `v`, a struct
+// or a pointer to one. Every key is preceded by the text of its `desc` tag
+// and the variable named by its `env` tag, and set to the value of its
+// `default` tag. Keys without a default, or with one derived from other
+// fields, are commented out. Nested structs become tables.
+func GenerateSample(v interface{}, format SampleFormat) ([]byte, error) {
+	t := derefType(reflect.TypeOf(v))
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("configo: cannot generate a sample for %T, want a struct", v)
+	}
+
+	var buf bytes.Buffer
+
+	switch format {
+	case SampleTOML:
+		sampleTOML(&buf, describe(t), nil)
+	case SampleYAML:
+		sampleYAML(&buf, describe(t), "")
+	default:
+		return nil, fmt.Errorf("configo: unknown sample format %d", format)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func sampleTOML(buf *bytes.Buffer, fields []fieldInfo, key []string) {
+	var tables []fieldInfo
+
+	for _, fi := range fields {
+		if fi.IsTable() || fi.IsTableArray() {
+			tables = append(tables, fi)
+			continue
+		}
+
+		sampleComments(buf, fi, "")
+
+		value, ok := sampleValue(fi)
+		if !ok {
+			buf.WriteString("# ")
+		}
+
+		buf.WriteString(tomlKey(fi.Key) + " = " + value + "\n")
+	}
+
+	for _, fi := range tables {
+		fkey := append(key[:len(key):len(key)], tomlKey(fi.Key))
+		header := "[" + strings.Join(fkey, ".") + "]"
+		if fi.IsTableArray() {
+			header = "[" + header + "]"
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+
+		sampleComments(buf, fi, "")
+		buf.WriteString(header + "\n")
+		sampleTOML(buf, fi.Fields, fkey)
+	}
+}
+
+func sampleYAML(buf *bytes.Buffer, fields []fieldInfo, indent string) {
+	for _, fi := range fields {
+		sampleComments(buf, fi, indent)
+
+		switch {
+		case fi.IsTable():
+			buf.WriteString(indent + tomlKey(fi.Key) + ":\n")
+			sampleYAML(buf, fi.Fields, indent+"  ")
+		case fi.IsTableArray():
+			buf.WriteString(indent + tomlKey(fi.Key) + ":\n")
+			buf.WriteString(indent + "  -\n")
+			sampleYAML(buf, fi.Fields, indent+"    ")
+		default:
+			value, ok := sampleValue(fi)
+			if !ok {
+				buf.WriteString(indent + "# ")
+			} else {
+				buf.WriteString(indent)
+			}
+
+			buf.WriteString(tomlKey(fi.Key) + ": " + value + "\n")
+		}
+	}
+}
+
+func sampleComments(buf *bytes.Buffer, fi fieldInfo, indent string) {
+	if fi.Desc != "" {
+		for _, line := range strings.Split(fi.Desc, "\n") {
+			buf.WriteString(indent + "# " + line + "\n")
+		}
+	}
+
+	if fi.Env != "" {
+		buf.WriteString(indent + "# env: " + fi.Env + "\n")
+	}
+}
+
+// sampleValue formats the default of a field, or its zero value when it has
+// no default, in which case ok is false. The result is valid as both TOML
+// and YAML.
+func sampleValue(fi fieldInfo) (value string, ok bool) {
+	if fi.Derived {
+		return tomlString(fi.Default), false
+	}
+
+	if fi.Default != "" {
+		return formatDefault(valueType(fi.Type), fi.Default), true
+	}
+
+	if fi.Type.Kind() == reflect.Map {
+		return "{}", false
+	}
+
+	s, err := tomlValue(reflect.Zero(fi.Type))
+	if err != nil {
+		return "", false
+	}
+
+	return s, false
+}
+
+// formatDefault formats the "default" tag `tag` of a field of type `t` as
+// the value the loaders would set.
+func formatDefault(t reflect.Type, tag string) string {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		d := reflect.New(t).Elem()
+		if set(&d, tag) == nil {
+			if s, err := tomlValue(d); err == nil {
+				return s
+			}
+		}
+	}
+
+	return tomlString(tag)
+}
@@ -0,0 +1,304 @@
+package configo
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema returns a JSON Schema (draft 2020-12) describing config files
+// for `v`, a struct or a pointer to one, so editors and CI can check them.
+//
+// Properties are named after TOML keys, and keys matching no field are
+// rejected, except for the aliases of fields, described as deprecated. The
+// schema carries each field's type, `desc` tag as description and `default`
+// tag, unless derived from other fields, as default. The "required", "min",
+// "max", "len", "oneof", "regexp" and "url" rules of its `validate` tag
+// become required, minimum/maximum (or the length and item count
+// equivalents), enum, pattern and format constraints. Fields a default or
+// an environment variable can set are not required in the file. The root
+// also accepts the integer VersionKey of files handled by Migrations. Recursive
+// types are described once under "$defs" and referred to with "$ref".
+func JSONSchema(v interface{}) ([]byte, error) {
+	t := derefType(reflect.TypeOf(v))
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("configo: cannot generate a schema for %T, want a struct", v)
+	}
+
+	b := &schemaBuilder{root: t, building: map[reflect.Type]bool{}, refs: map[reflect.Type]string{}, defs: schema{}}
+
+	s := b.structSchema(t)
+	for _, fi := range describe(t) {
+		b.addAliases(s, fi)
+	}
+
+	// Files migrated by Migrations carry their layout version.
+	if props := s["properties"].(schema); props[VersionKey] == nil {
+		props[VersionKey] = schema{"type": "integer", "minimum": 0, "description": "Layout version of the file."}
+	}
+
+	s["$schema"] = jsonSchemaDraft
+	s["title"] = t.Name()
+
+	if len(b.defs) > 0 {
+		s["$defs"] = b.defs
+	}
+
+	return json.MarshalIndent(s, "", "  ")
+}
+
+type schema map[string]interface{}
+
+// schemaBuilder builds the schema of a struct type. Struct types met again
+// while being built, i.e. recursive types, are referred to by "$ref".
+type schemaBuilder struct {
+	root     reflect.Type
+	building map[reflect.Type]bool
+	// refs holds the reference to each struct type referred to, and defs
+	// their schemas, but for the root, which is referred to as "#".
+	refs map[reflect.Type]string
+	defs schema
+}
+
+// structSchema returns the schema of struct type `t`, or a reference to it
+// if it is being built.
+func (b *schemaBuilder) structSchema(t reflect.Type) schema {
+	t = derefType(t)
+
+	if b.building[t] {
+		return schema{"$ref": b.ref(t)}
+	}
+
+	b.building[t] = true
+	s := b.objectSchema(describe(t))
+	delete(b.building, t)
+
+	if ref, ok := b.refs[t]; ok && t != b.root {
+		b.defs[strings.TrimPrefix(ref, "#/$defs/")] = s
+		return schema{"$ref": ref}
+	}
+
+	return s
+}
+
+// ref returns the reference to the recursive struct type `t`.
+func (b *schemaBuilder) ref(t reflect.Type) string {
+	if ref, ok := b.refs[t]; ok {
+		return ref
+	}
+
+	ref := "#"
+	if t != b.root {
+		name := t.String()
+		for i := 2; b.defs[name] != nil || b.taken(name); i++ {
+			name = fmt.Sprintf("%s%d", t.String(), i)
+		}
+
+		ref = "#/$defs/" + name
+	}
+
+	b.refs[t] = ref
+	return ref
+}
+
+// taken reports whether a reference to the definition `name` exists.
+func (b *schemaBuilder) taken(name string) bool {
+	for _, ref := range b.refs {
+		if ref == "#/$defs/"+name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *schemaBuilder) objectSchema(fields []fieldInfo) schema {
+	props := schema{}
+	var required []string
+
+	for _, fi := range fields {
+		props[fi.Key] = b.fieldSchema(fi)
+
+		if fi.Required() && fi.Default == "" && fi.Env == "" && fi.EnvAliases == nil {
+			required = append(required, fi.Key)
+		}
+	}
+
+	s := schema{"type": "object", "properties": props, "additionalProperties": false}
+	if required != nil {
+		s["required"] = required
+	}
+
+	return s
+}
+
+func (b *schemaBuilder) fieldSchema(fi fieldInfo) schema {
+	var s schema
+
+	switch {
+	case fi.IsTable():
+		s = b.structSchema(fi.Type)
+	case fi.IsTableArray():
+		s = schema{"type": "array", "items": b.structSchema(fi.Type.Elem())}
+	default:
+		s = b.typeSchema(fi.Type)
+	}
+
+	if fi.Desc != "" {
+		s["description"] = fi.Desc
+	}
+
+	if fi.Default != "" && !fi.Derived {
+		s["default"] = schemaValue(valueType(fi.Type), fi.Default)
+	}
+
+	for _, r := range parseRules(fi.Validate) {
+		applyRule(s, valueType(fi.Type), r)
+	}
+
+	return s
+}
+
+func (b *schemaBuilder) typeSchema(t reflect.Type) schema {
+	t = valueType(t)
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return schema{"type": "string", "format": "date-time"}
+	}
+
+	if t.Implements(textMarshaler) || reflect.PointerTo(t).Implements(textMarshaler) {
+		return schema{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return schema{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schema{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return schema{"type": "array", "items": b.typeSchema(t.Elem())}
+	case reflect.Map:
+		return schema{"type": "object", "additionalProperties": b.typeSchema(t.Elem())}
+	case reflect.Struct:
+		return b.structSchema(t)
+	}
+
+	return schema{}
+}
+
+// addAliases adds the aliases of field `fi` and of the fields nested in it
+// to the schema `root` of the whole file, as deprecated properties.
+func (b *schemaBuilder) addAliases(root schema, fi fieldInfo) {
+	for _, alias := range fi.Aliases {
+		s := root
+		parts := strings.Split(alias, ".")
+
+		for _, part := range parts[:len(parts)-1] {
+			props, ok := s["properties"].(schema)
+			if !ok {
+				break
+			}
+
+			next, ok := props[part].(schema)
+			if !ok {
+				next = schema{"type": "object", "properties": schema{}}
+				props[part] = next
+			}
+
+			s = next
+		}
+
+		if props, ok := s["properties"].(schema); ok {
+			if _, exists := props[parts[len(parts)-1]]; !exists {
+				as := b.fieldSchema(fi)
+				as["deprecated"] = true
+				props[parts[len(parts)-1]] = as
+			}
+		}
+	}
+
+	for _, nested := range fi.Fields {
+		b.addAliases(root, nested)
+	}
+}
+
+// schemaValue converts the tag value `s` to a JSON value of the type the
+// loaders would give a field of type `t`, falling back to the string.
+func schemaValue(t reflect.Type, s string) interface{} {
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+
+	return s
+}
+
+func applyRule(s schema, t reflect.Type, r rule) {
+	n, nerr := strconv.ParseFloat(r.Arg, 64)
+
+	// Bounds apply to the value of numbers and the length of anything else.
+	var minKey, maxKey string
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		minKey, maxKey = "minimum", "maximum"
+	case reflect.String:
+		minKey, maxKey = "minLength", "maxLength"
+	case reflect.Slice, reflect.Array:
+		minKey, maxKey = "minItems", "maxItems"
+	case reflect.Map:
+		minKey, maxKey = "minProperties", "maxProperties"
+	}
+
+	switch r.Name {
+	case "min", "max", "len":
+		if nerr != nil || minKey == "" {
+			return
+		}
+
+		if r.Name != "max" {
+			s[minKey] = n
+		}
+
+		if r.Name != "min" {
+			s[maxKey] = n
+		}
+	case "oneof":
+		var enum []interface{}
+		for _, opt := range strings.Split(r.Arg, "|") {
+			enum = append(enum, schemaValue(t, opt))
+		}
+
+		s["enum"] = enum
+	case "regexp":
+		s["pattern"] = r.Arg
+	case "url":
+		s["format"] = "uri"
+	}
+}
@@ -0,0 +1,107 @@
+package configo
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// secretMask replaces secret values wherever values are shown.
+const secretMask = "******"
+
+// Secret holds a sensitive config value such as a password. Printing it with
+// fmt, marshaling it as text or JSON, and every helper of this package show
+// it masked; Get returns the actual value.
+//
+// Secret fields are loaded like fields of type T, from "default" tags, TOML
+// files and environment variables alike. Fields of other types can be
+// marked sensitive with the `secret:"true"` tag instead.
+type Secret[T any] struct {
+	v T
+}
+
+// NewSecret returns a Secret holding `v`.
+func NewSecret[T any](v T) Secret[T] {
+	return Secret[T]{v: v}
+}
+
+// Get returns the value held by the secret.
+func (s Secret[T]) Get() T {
+	return s.v
+}
+
+func (s Secret[T]) String() string {
+	return secretMask
+}
+
+func (s Secret[T]) GoString() string {
+	return secretMask
+}
+
+// Format masks the secret for every fmt verb.
+func (s Secret[T]) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, secretMask)
+}
+
+func (s Secret[T]) MarshalText() ([]byte, error) {
+	return []byte(secretMask), nil
+}
+
+func (s Secret[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(secretMask)
+}
+
+// UnmarshalText sets the secret from `text`, converted to T as for any
+// other field.
+func (s *Secret[T]) UnmarshalText(text []byte) error {
+	v := reflect.ValueOf(&s.v).Elem()
+	return set(&v, string(text))
+}
+
+func (s Secret[T]) secret() interface{} {
+	return s.v
+}
+
+// secretValue is implemented by Secret.
+type secretValue interface {
+	secret() interface{}
+}
+
+var secretValueType = reflect.TypeOf((*secretValue)(nil)).Elem()
+
+// isSecret reports whether field `f` holds a value that must not be shown,
+// because it is tagged `secret:"true"` or is a Secret.
+func isSecret(f reflect.StructField) bool {
+	return f.Tag.Get("secret") == "true" || derefType(f.Type).Implements(secretValueType)
+}
+
+// secretError hides a secret value in the message of the error it wraps,
+// e.g. the input echoed by strconv errors.
+type secretError struct {
+	err   error
+	value string
+}
+
+func (e *secretError) Error() string {
+	if e.value == "" {
+		return e.err.Error()
+	}
+
+	return strings.ReplaceAll(e.err.Error(), e.value, secretMask)
+}
+
+func (e *secretError) Unwrap() error {
+	return e.err
+}
+
+// newFieldError returns a *FieldError, masking `value` when the field is
+// secret.
+func newFieldError(path, source, value string, secret bool, err error) *FieldError {
+	if secret {
+		err = &secretError{err: err, value: value}
+		value = secretMask
+	}
+
+	return &FieldError{Path: path, Source: source, Value: value, Err: err}
+}
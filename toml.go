@@ -1,21 +1,73 @@
 package configo
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
 	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
 
 type TomlConfigo struct {
-	file string
+	file       string
+	strict     bool
+	key        KeySource
+	logger     Logger
+	migrations *Migrations
 }
 
 func NewTomlConfigo(file string) *TomlConfigo {
 	return &TomlConfigo{file: file}
 }
 
+// Strict makes Load fail on keys in the file that match no field. Each such
+// key is reported as an *UnknownKeyError.
+func (tc *TomlConfigo) Strict() *TomlConfigo {
+	tc.strict = true
+	return tc
+}
+
+// Migrations makes Load migrate the file with `ms` before decoding it. The
+// file itself is left as it is; see Migrations.MigrateFile.
+func (tc *TomlConfigo) Migrations(ms *Migrations) *TomlConfigo {
+	tc.migrations = ms
+	return tc
+}
+
+// Key sets the key encrypted values in the file are decrypted with, instead
+// of DefaultKey. See Encrypt.
+func (tc *TomlConfigo) Key(key KeySource) *TomlConfigo {
+	tc.key = key
+	return tc
+}
+
+// Logger sets where warnings about aliases and deprecated keys are logged.
+// Without a Logger, they are dropped.
+func (tc *TomlConfigo) Logger(l Logger) *TomlConfigo {
+	tc.logger = l
+	return tc
+}
+
+func (tc *TomlConfigo) useLogger(l Logger) {
+	if tc.logger == nil {
+		tc.logger = l
+	}
+}
+
 func (tc *TomlConfigo) Load(v interface{}) error {
-	return FromTOML(tc.file, v)
+	return tc.load(v, nil)
+}
+
+func (tc *TomlConfigo) track(v interface{}, p Provenance) error {
+	return tc.load(v, p)
+}
+
+func (tc *TomlConfigo) files() []string {
+	return []string{tc.file}
 }
 
 // FromTOML decodes the contents of the file `f` in TOML format into a pointer `v`.
@@ -24,49 +76,450 @@ func (tc *TomlConfigo) Load(v interface{}) error {
 //
 // 1. If the field exists in the file, its value will be used. The `toml` tag may be used to map TOML keys to fields that don't match the key name exactly.
 // 2. If `v` already contains a value for the field, it will be used.
+//
+// Values encrypted with Encrypt are decrypted with DefaultKey.
 func FromTOML(f string, v interface{}) error {
-	rv := reflect.ValueOf(v).Elem()
+	return NewTomlConfigo(f).Load(v)
+}
+
+func (tc *TomlConfigo) load(v interface{}, p Provenance) error {
+	f := tc.file
+	rv, err := target(v)
+	if err != nil {
+		return err
+	}
+
+	b, err := os.ReadFile(f)
+	if err != nil {
+		return err
+	}
+
+	key := tc.key
+	if key == nil {
+		key = DefaultKey
+	}
+
+	b, err = tomlDecrypt(f, b, rv.Type(), key)
+	if err != nil {
+		return err
+	}
+
+	// Lines refer to the file as written, so keys moved by a migration
+	// are reported without one.
+	lines := tomlKeyLines(b)
+
+	migrated := tc.migrations != nil
+	if migrated {
+		b, _, _, err = tc.migrations.toml(b)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f, err)
+		}
+	}
 
 	// Unmarshalling TOML onto a non-zero struct is inconsistent.
 	// One time the value might be the pre-existing value, another time
 	// it might be from the TOML. Instead we unmarshal onto a new struct
-	// then walk the struct copying non-zero values.
+	// then walk the struct copying the values of the keys the file sets.
 
 	nv := reflect.New(rv.Type())
 	ni := nv.Interface()
-	_, err := toml.DecodeFile(f, ni)
+	md, err := toml.Decode(string(b), ni)
 	if err != nil {
+		return tomlDecodeError(f, b, lines, rv.Type(), err)
+	}
+
+	var errs LoadErrors
+
+	defined := tomlDefined(md)
+
+	known, err := tomlAliases(f, b, nv, lines, defined, tc.logger)
+	errs.add(err)
+
+	if migrated {
+		if known == nil {
+			known = map[string]bool{}
+		}
+
+		known[VersionKey] = true
+	}
+
+	if tc.strict {
+		errs.add(tomlUnknownKeys(f, md.Undecoded(), lines, known))
+	}
+
+	var o *tomlOrigins
+	if p != nil {
+		o = &tomlOrigins{file: f, lines: lines, prov: p}
+	}
+
+	errs.add(setToml(&rv, nv.Elem(), "", "", defined, o))
+
+	return errs.err()
+}
+
+// tomlUnknownKeys reports every key in `undecoded` but the `known` keys,
+// such as aliases, and their children. Keys inside an unknown table are
+// covered by the table itself.
+func tomlUnknownKeys(f string, undecoded []toml.Key, lines map[string]int, known map[string]bool) error {
+	var errs LoadErrors
+
+	unknown := map[string]bool{}
+	for _, k := range undecoded {
+		unknown[normalizeTomlKey(k.String())] = true
+	}
+
+	// Tables holding an alias are known too, but not their other keys.
+	holders := map[string]bool{}
+	for key := range known {
+		for i := strings.LastIndex(key, "."); i >= 0; i = strings.LastIndex(key[:i], ".") {
+			holders[key[:i]] = true
+		}
+	}
+
+	for _, k := range undecoded {
+		key := normalizeTomlKey(k.String())
+
+		covered := known[key] || holders[key]
+		for i := strings.LastIndex(key, "."); i >= 0; i = strings.LastIndex(key[:i], ".") {
+			if unknown[key[:i]] && !holders[key[:i]] || known[key[:i]] {
+				covered = true
+				break
+			}
+		}
+
+		if covered {
+			continue
+		}
+
+		errs.add(&UnknownKeyError{Key: k.String(), Source: "toml:" + tomlPos(f, lines[key])})
+	}
+
+	return errs.err()
+}
+
+// tomlDecodeError converts a failure to decode the values of keys into a
+// *FieldError per key, naming the field the key maps onto and wrapping the
+// error of that key alone. Syntax errors, and errors no key can be found
+// for, are returned unchanged.
+func tomlDecodeError(f string, b []byte, lines map[string]int, t reflect.Type, err error) error {
+	var pe toml.ParseError
+	if errors.As(err, &pe) {
+		return err
+	}
+
+	var doc map[string]toml.Primitive
+	md, derr := toml.Decode(string(b), &doc)
+	if derr != nil {
 		return err
 	}
 
-	return setToml(&rv, nv.Elem())
+	failures := tomlFailingKeys(md, doc, t, "")
+	if failures == nil {
+		return err
+	}
+
+	sort.SliceStable(failures, func(i, j int) bool {
+		return lines[failures[i].key] < lines[failures[j].key]
+	})
+
+	var raw map[string]interface{}
+	if _, derr := toml.Decode(string(b), &raw); derr != nil {
+		raw = nil
+	}
+
+	var errs LoadErrors
+
+	for _, fk := range failures {
+		var value string
+		if v, ok := tomlLookup(raw, fk.key); ok {
+			value = fmt.Sprint(v)
+		}
+
+		path, secret := tomlKeyField(t, fk.key)
+		errs.add(newFieldError(path, "toml:"+tomlPos(f, lines[fk.key]), value, secret, fk.err))
+	}
+
+	return errs.err()
 }
 
-func setToml(dst *reflect.Value, src reflect.Value) error {
+// tomlKeyError is the failure to decode the value of a key.
+type tomlKeyError struct {
+	// key is the normalized dotted key.
+	key string
+	err error
+}
+
+// tomlFailingKeys decodes each key of the `table` under `key` into the field
+// of the struct type `t` it maps onto, and returns the keys that fail with
+// their own errors, looking into tables for the innermost.
+func tomlFailingKeys(md toml.MetaData, table map[string]toml.Primitive, t reflect.Type, key string) []tomlKeyError {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	keys := make([]string, 0, len(table))
+	for k := range table {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var failures []tomlKeyError
+
+	for _, k := range keys {
+		name := strings.ToLower(k)
+
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.PkgPath != "" || tomlName(sf) != name {
+				continue
+			}
+
+			fkey := joinPath(key, name)
+
+			err := md.PrimitiveDecode(table[k], reflect.New(sf.Type).Interface())
+			if err == nil {
+				break
+			}
+
+			var sub map[string]toml.Primitive
+			if md.PrimitiveDecode(table[k], &sub) == nil {
+				if inner := tomlFailingKeys(md, sub, sf.Type, fkey); inner != nil {
+					failures = append(failures, inner...)
+					break
+				}
+			}
+
+			failures = append(failures, tomlKeyError{key: fkey, err: err})
+			break
+		}
+	}
+
+	return failures
+}
+
+// tomlPos returns the position "file:line" of a key in the file `f`, or just
+// the file if the line is unknown.
+func tomlPos(f string, line int) string {
+	if line <= 0 {
+		return f
+	}
+
+	return fmt.Sprintf("%s:%d", f, line)
+}
+
+// tomlLookup finds the value of the normalized dotted `key` in a decoded
+// document, matching keys case-insensitively.
+func tomlLookup(doc map[string]interface{}, key string) (interface{}, bool) {
+	var cur interface{} = doc
+
+	for _, part := range strings.Split(key, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		found := false
+		for k, v := range m {
+			if strings.ToLower(k) == part {
+				cur, found = v, true
+				break
+			}
+		}
+
+		if !found {
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+// tomlKeyField maps the normalized dotted TOML `key` onto the path of the
+// field of `t` it decodes into, and reports whether that field is secret.
+// Parts that match no field are kept as-is.
+func tomlKeyField(t reflect.Type, key string) (path string, secret bool) {
+	for _, part := range strings.Split(key, ".") {
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		name := part
+
+		if t != nil && t.Kind() == reflect.Struct {
+			var next reflect.Type
+			for i := 0; i < t.NumField(); i++ {
+				if tomlName(t.Field(i)) == part {
+					name = t.Field(i).Name
+					next = t.Field(i).Type
+					secret = secret || isSecret(t.Field(i))
+					break
+				}
+			}
+			t = next
+		} else {
+			t = nil
+		}
+
+		path = joinPath(path, name)
+	}
+
+	return path, secret
+}
+
+// tomlOrigins records the provenance of values copied out of a TOML file.
+type tomlOrigins struct {
+	file  string
+	lines map[string]int
+	prov  Provenance
+}
+
+func (o *tomlOrigins) record(path, key string) {
+	if o == nil {
+		return
+	}
+
+	o.prov.record(path, Origin{Source: "toml", File: o.file, Line: o.lines[key]})
+}
+
+// tomlName returns the key BurntSushi/toml matches a field against,
+// lowercased since keys are matched case-insensitively.
+func tomlName(f reflect.StructField) string {
+	name := f.Tag.Get("toml")
+	if i := strings.Index(name, ","); i >= 0 {
+		name = name[:i]
+	}
+
+	if name == "" {
+		name = f.Name
+	}
+
+	return strings.ToLower(name)
+}
+
+// tomlKeyLines maps each key defined in a TOML document, lowercased and
+// dotted from the root, to the line the decoder reports for it. It is empty
+// if the document does not parse.
+func tomlKeyLines(b []byte) map[string]int {
+	lines := map[string]int{}
+
+	var doc map[string]toml.Primitive
+	md, err := toml.Decode(string(b), &doc)
+	if err != nil {
+		return lines
+	}
+
+	for k, prim := range doc {
+		tomlPrimitiveLines(b, md, prim, strings.ToLower(k), lines)
+	}
+
+	return lines
+}
+
+// errTomlLine is returned by tomlLineProbe so the decoder reports the
+// position of the key being decoded.
+var errTomlLine = errors.New("configo: line probe")
+
+// tomlLineProbe fails to decode any value, so decoding a toml.Primitive into
+// it yields a toml.ParseError holding the position of the key.
+type tomlLineProbe struct{}
+
+func (tomlLineProbe) UnmarshalTOML(interface{}) error { return errTomlLine }
+
+// tomlPrimitiveLines records in `lines` the line of `key`, whose value is
+// `prim`, and of the keys of the tables it holds. The line is the one the
+// value starts on, counted from the offset the decoder reports, since its
+// line is where a multi-line value ends.
+func tomlPrimitiveLines(b []byte, md toml.MetaData, prim toml.Primitive, key string, lines map[string]int) {
+	var pe toml.ParseError
+	err := md.PrimitiveDecode(prim, &tomlLineProbe{})
+	if errors.As(err, &pe) && pe.Position.Line > 0 && pe.Position.Start <= len(b) {
+		if _, ok := lines[key]; !ok {
+			lines[key] = bytes.Count(b[:pe.Position.Start], []byte("\n")) + 1
+		}
+	}
+
+	// Arrays of tables decode into a map too, so they are tried first.
+	var tables []map[string]toml.Primitive
+	if md.PrimitiveDecode(prim, &tables) != nil {
+		var table map[string]toml.Primitive
+		if md.PrimitiveDecode(prim, &table) != nil {
+			return
+		}
+
+		tables = []map[string]toml.Primitive{table}
+	}
+
+	for _, table := range tables {
+		for k, p := range table {
+			tomlPrimitiveLines(b, md, p, joinPath(key, strings.ToLower(k)), lines)
+		}
+	}
+}
+
+func normalizeTomlKey(k string) string {
+	parts := strings.Split(k, ".")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.Trim(strings.TrimSpace(part), `"'`))
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// tomlDefined returns the lowercased dotted keys defined in the document
+// decoded into `md`.
+func tomlDefined(md toml.MetaData) map[string]bool {
+	defined := map[string]bool{}
+	for _, k := range md.Keys() {
+		defined[strings.ToLower(strings.Join(k, "."))] = true
+	}
+
+	return defined
+}
+
+// setToml copies to `dst` the fields of `src`, decoded from a TOML file,
+// whose key is `defined` in the file, zero values included, so a file
+// overrides whatever earlier sources set.
+func setToml(dst *reflect.Value, src reflect.Value, path, key string, defined map[string]bool, o *tomlOrigins) error {
 	var err error
 
 	// TODO: Don't assume src and dst are the same
 
 	switch dst.Kind() {
 	case reflect.Ptr:
+		if src.IsNil() {
+			return nil
+		}
+
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+
 		dnv := dst.Elem()
 		snv := src.Elem()
 
-		err = setToml(&dnv, snv)
+		err = setToml(&dnv, snv, path, key, defined, o)
 		if err != nil {
 			return err
 		}
 
 		dst = &dnv
 	case reflect.Struct:
-		for i := 0; i < dst.NumField(); i++ {
-			dval := dst.Field(i)
-			sval := src.Field(i)
+		plan := planFor(dst.Type())
 
-			kind := dval.Kind()
+		for i := range plan.fields {
+			fp := &plan.fields[i]
+			dval := dst.Field(fp.index)
+			sval := src.Field(fp.index)
+			fpath := joinPath(path, fp.name)
+			fkey := joinPath(key, fp.tomlKey)
 
-			if kind == reflect.Struct {
-				err = setToml(&dval, sval)
+			if fp.nested(dval) {
+				err = setToml(&dval, sval, fpath, fkey, defined, o)
 				if err != nil {
 					return err
 				}
@@ -74,25 +527,11 @@ func setToml(dst *reflect.Value, src reflect.Value) error {
 				continue
 			}
 
-			if kind == reflect.Ptr && dval.Elem().Kind() == reflect.Struct {
-				err = setToml(&dval, sval)
-				if err != nil {
-					return err
-				}
-
-				continue
-			}
-
-			if !isZero(sval) {
+			if defined[fkey] {
 				dval.Set(sval)
+				o.record(fpath, fkey)
 			}
 		}
-	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.String:
-		if !isZero(src) {
-			dst.Set(src)
-		}
-	default:
-		// TODO: Do something with unknown value types
 	}
 
 	return nil
@@ -0,0 +1,255 @@
+package configo
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kimor79/configo/internal/tags"
+)
+
+// ValidateConfigo checks the merged config against the rules in its
+// "validate" tags. It is meant to be the last link of a ConfigoChain.
+type ValidateConfigo struct{}
+
+func NewValidateConfigo() *ValidateConfigo { return &ValidateConfigo{} }
+
+func (vc *ValidateConfigo) merged() {}
+
+func (vc *ValidateConfigo) Load(v interface{}) error {
+	return Validate(v)
+}
+
+// RuleError is wrapped by the *FieldError of a field that breaks a rule in
+// its "validate" tag.
+type RuleError struct {
+	// Rule is the rule as written in the tag, e.g. "min=1".
+	Rule string
+}
+
+func (e *RuleError) Error() string {
+	return "failed rule " + e.Rule
+}
+
+// Validate checks every field of pointer `v` against the comma separated
+// rules in its "validate" tag. Nested structs are checked too.
+//
+// The following rules are supported:
+//
+//	required      the field must not be its zero value (pointers are dereferenced)
+//	min=N, max=N  numbers must be within the bound, strings, slices and maps must have a length within it
+//	len=N         strings, slices and maps must have exactly N elements
+//	oneof=a|b|c   the field must be one of the listed values
+//	regexp=RE     strings must match RE; since RE may contain commas it must be the last rule
+//	url           strings must be an absolute URL
+//	hostport      strings must be a "host:port" pair
+//	file_exists   strings must name an existing file
+//
+// Rules other than required, min, max and len are skipped for empty values
+// so optional fields may be left unset. The returned error is a *LoadErrors
+// holding a *FieldError wrapping a *RuleError for every broken rule.
+func Validate(v interface{}) error {
+	rv, err := target(v)
+	if err != nil {
+		return err
+	}
+
+	var errs LoadErrors
+	validate(rv, "", &errs)
+	return errs.err()
+}
+
+func validate(v reflect.Value, path string, errs *LoadErrors) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+
+		validate(v.Elem(), path, errs)
+	case reflect.Struct:
+		plan := planFor(v.Type())
+
+		for i := range plan.fields {
+			fp := &plan.fields[i]
+			val := v.Field(fp.index)
+			fpath := joinPath(path, fp.name)
+
+			for _, r := range fp.rules {
+				err := r.check(val)
+				if err != nil {
+					errs.add(newFieldError(fpath, "validate", display(val), fp.secret, err))
+				}
+			}
+
+			if fp.nested(val) {
+				validate(val, fpath, errs)
+			}
+		}
+	}
+}
+
+// display formats a field's value for error messages, dereferencing pointers.
+func display(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+
+		v = v.Elem()
+	}
+
+	if !v.CanInterface() {
+		return ""
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+// rule is a rule of a "validate" tag.
+type rule struct{ tags.Rule }
+
+func parseRules(tag string) []rule {
+	var rules []rule
+
+	for _, r := range tags.ParseRules(tag) {
+		rules = append(rules, rule{r})
+	}
+
+	return rules
+}
+
+// check returns a *RuleError if `v` breaks the rule, or an error describing
+// why the rule itself is malformed.
+func (r rule) check(v reflect.Value) error {
+	// Rules apply to the value behind pointers and secrets.
+	for {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v = reflect.Zero(v.Type().Elem())
+				continue
+			}
+
+			v = v.Elem()
+			continue
+		}
+
+		if sv, ok := v.Interface().(secretValue); ok {
+			v = reflect.ValueOf(sv.secret())
+			continue
+		}
+
+		break
+	}
+
+	ok, err := r.holds(v)
+	if err != nil {
+		return fmt.Errorf("rule %s: %s", r, err)
+	}
+
+	if !ok {
+		return &RuleError{Rule: r.String()}
+	}
+
+	return nil
+}
+
+func (r rule) holds(v reflect.Value) (bool, error) {
+	switch r.Name {
+	case "required":
+		return !v.IsZero(), nil
+	case "min", "max", "len":
+		return checkBound(r.Name, r.Arg, v)
+	case "oneof", "regexp", "url", "hostport", "file_exists":
+	default:
+		return false, fmt.Errorf("unknown rule")
+	}
+
+	if v.IsZero() {
+		return true, nil
+	}
+
+	switch r.Name {
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, opt := range strings.Split(r.Arg, "|") {
+			if s == opt {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}
+
+	if v.Kind() != reflect.String {
+		return false, fmt.Errorf("not supported for %s", v.Type())
+	}
+
+	s := v.String()
+
+	switch r.Name {
+	case "regexp":
+		re, err := regexp.Compile(r.Arg)
+		if err != nil {
+			return false, err
+		}
+
+		return re.MatchString(s), nil
+	case "url":
+		u, err := url.Parse(s)
+		if err != nil {
+			return false, nil
+		}
+
+		return u.Scheme != "" && (u.Host != "" || u.Path != "" || u.Opaque != ""), nil
+	case "hostport":
+		_, port, err := net.SplitHostPort(s)
+		if err != nil {
+			return false, nil
+		}
+
+		n, err := strconv.ParseUint(port, 10, 16)
+		return err == nil && n > 0, nil
+	case "file_exists":
+		_, err := os.Stat(s)
+		return err == nil, nil
+	}
+
+	return true, nil
+}
+
+func checkBound(name, arg string, v reflect.Value) (bool, error) {
+	var n float64
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		n = float64(v.Len())
+	default:
+		return false, fmt.Errorf("not supported for %s", v.Type())
+	}
+
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return false, err
+	}
+
+	switch name {
+	case "min":
+		return n >= bound, nil
+	case "max":
+		return n <= bound, nil
+	}
+
+	return n == bound, nil
+}
@@ -0,0 +1,303 @@
+package configo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// Watcher reloads a config of type T through a ConfigoChain whenever one of
+// the chain's files changes.
+//
+// Each reload decodes into a fresh T, so a failed or invalid load never
+// leaves a half-updated config behind. The new config is only published,
+// and subscribers only notified, if the chain loads it without error. The
+// current config lives in a Holder, so reads never block on a reload.
+type Watcher[T any] struct {
+	chain    *ConfigoChain
+	holder   *Holder[T]
+	debounce time.Duration
+	poll     time.Duration
+	logger   Logger
+
+	// mu serializes loads and guards the callbacks.
+	mu   sync.Mutex
+	subs []func(old, new T)
+	errs []func(error)
+}
+
+// NewWatcher returns a Watcher loading configs through `chain`. Call Reload
+// for the initial load, then Watch to follow changes.
+func NewWatcher[T any](chain *ConfigoChain) *Watcher[T] {
+	return &Watcher[T]{
+		chain:    chain,
+		holder:   NewHolder[T](nil),
+		debounce: 100 * time.Millisecond,
+		poll:     time.Second,
+	}
+}
+
+// Debounce sets how long the files must stay unchanged before a reload, so
+// a burst of writes triggers a single reload. The default is 100ms.
+func (w *Watcher[T]) Debounce(d time.Duration) *Watcher[T] {
+	w.debounce = d
+	return w
+}
+
+// PollInterval sets how often files are checked for changes when the
+// platform offers no file notifications. The default is 1s.
+func (w *Watcher[T]) PollInterval(d time.Duration) *Watcher[T] {
+	w.poll = d
+	return w
+}
+
+// Logger sets where the outcome of every reload is logged.
+func (w *Watcher[T]) Logger(l Logger) *Watcher[T] {
+	w.logger = l
+	return w
+}
+
+// OnChange registers `fn` to be called after every successful reload with
+// the previous and the new config.
+func (w *Watcher[T]) OnChange(fn func(old, new T)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.subs = append(w.subs, fn)
+}
+
+// OnError registers `fn` to be called with the error of every failed reload.
+func (w *Watcher[T]) OnError(fn func(error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.errs = append(w.errs, fn)
+}
+
+// Current returns the last successfully loaded config, or nil before the
+// first successful Reload. It is safe to call from any goroutine.
+func (w *Watcher[T]) Current() *T {
+	return w.holder.Get()
+}
+
+// Holder returns the Holder the watcher publishes configs to.
+func (w *Watcher[T]) Holder() *Holder[T] {
+	return w.holder
+}
+
+// Reload loads a fresh config through the chain and, if that succeeds,
+// publishes it and notifies subscribers. On failure the current config is
+// kept and the error is passed to OnError callbacks and returned.
+//
+// Callbacks run after the reload completes, without any lock held, so they
+// may register further callbacks or call Reload themselves.
+func (w *Watcher[T]) Reload() error {
+	w.mu.Lock()
+
+	next := new(T)
+
+	err := w.chain.Load(next)
+	if err != nil {
+		errs := append([]func(error){}, w.errs...)
+		w.mu.Unlock()
+
+		w.logf("config reload failed, keeping current config: %s", err)
+
+		for _, fn := range errs {
+			fn(err)
+		}
+
+		return err
+	}
+
+	prev := w.holder.Swap(next)
+	subs := append([]func(old, new T){}, w.subs...)
+	w.mu.Unlock()
+
+	var old T
+	if prev != nil {
+		old = *prev
+	}
+
+	switch {
+	case prev == nil:
+		w.logf("config loaded")
+	case w.logger != nil:
+		changes := Diff(prev, next)
+		if len(changes) == 0 {
+			w.logf("config reloaded, nothing changed")
+		}
+
+		for _, c := range changes {
+			w.logf("config changed: %s", c)
+		}
+	}
+
+	for _, fn := range subs {
+		fn(old, *next)
+	}
+
+	return nil
+}
+
+// Watch reloads the config whenever one of the chain's files changes, until
+// `ctx` is done. Changes are picked up through file notifications where the
+// platform supports them and by polling otherwise.
+func (w *Watcher[T]) Watch(ctx context.Context) error {
+	files := w.chain.files()
+
+	n, err := newFileNotifier(files)
+	if err != nil {
+		n = newPoller(files, w.poll)
+	}
+	defer n.close()
+
+	var timer *time.Timer
+	var fire <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+
+			return ctx.Err()
+		case <-n.events():
+			if timer == nil {
+				timer = time.NewTimer(w.debounce)
+			} else {
+				timer.Reset(w.debounce)
+			}
+
+			fire = timer.C
+		case <-fire:
+			fire = nil
+
+			// Failures are reported through OnError.
+			_ = w.Reload()
+		}
+	}
+}
+
+// WatchSignals reloads the config every time the process receives one of
+// `sigs`, SIGHUP if none are given, until `ctx` is done. Reloads go through
+// Reload, so subscribers are notified exactly as for file changes and a
+// failed reload keeps the current config. Platforms without SIGHUP require
+// `sigs`.
+func (w *Watcher[T]) WatchSignals(ctx context.Context, sigs ...os.Signal) error {
+	if len(sigs) == 0 {
+		sigs = reloadSignals
+	}
+
+	if len(sigs) == 0 {
+		return errors.New("configo: no reload signal given and no default on this platform")
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case sig := <-ch:
+			w.logf("received %s, reloading config", sig)
+
+			// Failures are reported through OnError.
+			_ = w.Reload()
+		}
+	}
+}
+
+func (w *Watcher[T]) logf(format string, v ...interface{}) {
+	if w.logger != nil {
+		w.logger.Printf(format, v...)
+	}
+}
+
+// fileSource is implemented by sources that read files, so a Watcher knows
+// what to watch.
+type fileSource interface {
+	files() []string
+}
+
+// notifier signals changes to a set of files.
+type notifier interface {
+	events() <-chan struct{}
+	close() error
+}
+
+// poller is a notifier checking the size and modification time of files at
+// a fixed interval.
+type poller struct {
+	ch   chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func newPoller(files []string, interval time.Duration) *poller {
+	p := &poller{ch: make(chan struct{}, 1), done: make(chan struct{})}
+
+	// A missing file is stamped as the zero value so that removing and
+	// recreating it both count as changes.
+	type stamp struct {
+		mod  int64
+		size int64
+	}
+
+	stat := func() []stamp {
+		s := make([]stamp, len(files))
+		for i, f := range files {
+			fi, err := os.Stat(f)
+			if err == nil {
+				s[i] = stamp{mod: fi.ModTime().UnixNano(), size: fi.Size()}
+			}
+		}
+
+		return s
+	}
+
+	last := stat()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+			}
+
+			cur := stat()
+
+			for i := range cur {
+				if cur[i] != last[i] {
+					select {
+					case p.ch <- struct{}{}:
+					default:
+					}
+
+					break
+				}
+			}
+
+			last = cur
+		}
+	}()
+
+	return p
+}
+
+func (p *poller) events() <-chan struct{} { return p.ch }
+
+func (p *poller) close() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
@@ -0,0 +1,134 @@
+//go:build linux
+
+package configo
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotify is a notifier backed by Linux inotify. It watches the directories
+// containing the files rather than the files themselves, so changes made by
+// editors and deploy tools that replace a file by renaming over it are seen.
+// Events on other entries of a directory, such as the "..data" symlink a
+// Kubernetes ConfigMap volume swaps on update, count when a file they hold
+// resolves to different contents afterwards.
+type inotify struct {
+	f    *os.File
+	ch   chan struct{}
+	once sync.Once
+}
+
+const inotifyMask = syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_CREATE |
+	syscall.IN_DELETE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM | syscall.IN_ATTRIB
+
+func newFileNotifier(files []string) (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	// names maps each watch descriptor to the base names of the files
+	// watched in its directory, and their paths.
+	names := map[int32]map[string]string{}
+	dirs := map[string]int32{}
+
+	for _, f := range files {
+		dir, base := filepath.Split(filepath.Clean(f))
+		if dir == "" {
+			dir = "."
+		}
+
+		wd, ok := dirs[dir]
+		if !ok {
+			n, err := syscall.InotifyAddWatch(fd, dir, inotifyMask)
+			if err != nil {
+				syscall.Close(fd)
+				return nil, os.NewSyscallError("inotify_add_watch", err)
+			}
+
+			wd = int32(n)
+			dirs[dir] = wd
+			names[wd] = map[string]string{}
+		}
+
+		names[wd][base] = f
+	}
+
+	// A non-blocking descriptor is served by the runtime poller, so closing
+	// the file unblocks the reader below.
+	in := &inotify{f: os.NewFile(uintptr(fd), "inotify"), ch: make(chan struct{}, 1)}
+
+	go in.read(names)
+
+	return in, nil
+}
+
+func (in *inotify) read(names map[int32]map[string]string) {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	stats := map[string]os.FileInfo{}
+	for _, files := range names {
+		for _, f := range files {
+			stats[f], _ = os.Stat(f)
+		}
+	}
+
+	// changed reports whether a file in the directory of `wd` resolves to
+	// something else than when last checked.
+	changed := func(wd int32) bool {
+		found := false
+
+		for _, f := range names[wd] {
+			fi, _ := os.Stat(f)
+			last := stats[f]
+			stats[f] = fi
+
+			switch {
+			case fi == nil || last == nil:
+				found = found || fi != last
+			case !os.SameFile(fi, last) || !fi.ModTime().Equal(last.ModTime()) || fi.Size() != last.Size():
+				found = true
+			}
+		}
+
+		return found
+	}
+
+	for {
+		n, err := in.f.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameBytes := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+			off += syscall.SizeofInotifyEvent + int(ev.Len)
+
+			name := string(nameBytes)
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+
+			_, watched := names[ev.Wd][name]
+			if changed(ev.Wd) || watched {
+				select {
+				case in.ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+func (in *inotify) events() <-chan struct{} { return in.ch }
+
+func (in *inotify) close() error {
+	var err error
+	in.once.Do(func() { err = in.f.Close() })
+	return err
+}
@@ -0,0 +1,82 @@
+//go:build linux
+
+package configo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWatcherConfigMap updates a config laid out as in a Kubernetes
+// ConfigMap volume, where the file is a symlink through "..data" and an
+// update swaps "..data" to a new directory.
+func TestWatcherConfigMap(t *testing.T) {
+	dir := t.TempDir()
+
+	version := func(name, content string) {
+		err := os.Mkdir(filepath.Join(dir, name), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(filepath.Join(dir, name, "config.toml"), []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tmp := filepath.Join(dir, "..data_tmp")
+
+		err = os.Symlink(name, tmp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Rename(tmp, filepath.Join(dir, "..data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	version("..v1", "port = 1000\n")
+
+	file := filepath.Join(dir, "config.toml")
+
+	err := os.Symlink(filepath.Join("..data", "config.toml"), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWatcher[TestWatch](NewDefaultConfigoChain(file)).Debounce(10 * time.Millisecond)
+
+	err = w.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan int, 1)
+	w.OnChange(func(old, new TestWatch) {
+		select {
+		case changes <- new.Port:
+		default:
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go w.Watch(ctx)
+
+	n := 1
+	port := testAwait(t, changes, func() {
+		n++
+		version(fmt.Sprintf("..v%d", n), "port = 2000\n")
+	})
+
+	assert.Equal(t, 2000, port)
+}
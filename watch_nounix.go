@@ -0,0 +1,9 @@
+//go:build !unix
+
+package configo
+
+import "os"
+
+// reloadSignals are the signals WatchSignals reloads on by default. There is
+// no SIGHUP outside Unix, so callers must name the signals.
+var reloadSignals []os.Signal
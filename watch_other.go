@@ -0,0 +1,11 @@
+//go:build !linux
+
+package configo
+
+import "errors"
+
+// newFileNotifier reports that file notifications are unavailable, making
+// Watch fall back to polling.
+func newFileNotifier(files []string) (notifier, error) {
+	return nil, errors.New("file notifications not supported on this platform")
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package configo
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals are the signals WatchSignals reloads on by default.
+var reloadSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,67 @@
+//go:build unix
+
+package configo
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcherSignals(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "signal.toml")
+
+	err := os.WriteFile(file, []byte("port = 1000\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := &testLogger{}
+	w := NewWatcher[TestWatch](NewDefaultConfigoChain(file)).Logger(logger)
+
+	err = w.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan int, 1)
+	w.OnChange(func(old, new TestWatch) {
+		select {
+		case changes <- new.Port:
+		default:
+		}
+	})
+
+	// Registering here keeps SIGUSR1 from killing the process before the
+	// watcher subscribes to it.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+	defer signal.Stop(sigs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go w.WatchSignals(ctx, syscall.SIGUSR1)
+
+	err = os.WriteFile(file, []byte("port = 2000\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The watcher may not be subscribed yet, so signal until it reloads.
+	port := testAwait(t, changes, func() {
+		err := syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	assert.Equal(t, 2000, port)
+	assert.Contains(t, logger.String(), "received user defined signal 1, reloading config")
+	assert.Contains(t, logger.String(), "config changed: Port: 1000 -> 2000")
+}